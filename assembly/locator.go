@@ -2,48 +2,122 @@ package assembly
 
 import (
 	"fmt"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/graduate-work-mirea/data-processor-service/config"
 	"github.com/graduate-work-mirea/data-processor-service/controller"
+	"github.com/graduate-work-mirea/data-processor-service/internal/featurespec"
+	"github.com/graduate-work-mirea/data-processor-service/internal/leader"
+	"github.com/graduate-work-mirea/data-processor-service/internal/plugin"
 	"github.com/graduate-work-mirea/data-processor-service/internal/rabbitmq"
+	"github.com/graduate-work-mirea/data-processor-service/internal/schedule"
 	"github.com/graduate-work-mirea/data-processor-service/repository"
 	"github.com/graduate-work-mirea/data-processor-service/service"
 	"go.uber.org/zap"
 )
 
 type ServiceLocator struct {
-	Config               *config.Config
-	RabbitClient         *rabbitmq.Client
-	Logger               *zap.SugaredLogger
-	FileRepository       *repository.FileRepository
-	RabbitMQRepository   *repository.RabbitMQRepository
-	PostgresRepository   *repository.PostgresRepository
-	DataProcessorService *service.DataProcessorService
-	RabbitMQController   *controller.RabbitMQController
+	Config         *config.Config
+	Logger         *zap.SugaredLogger
+	Pipelines      []*Pipeline
+	HTTPController *controller.HTTPController
+}
+
+// Pipeline holds the components of one configured pipeline
+type Pipeline struct {
+	Name                   string
+	RabbitClient           *rabbitmq.Client
+	FileRepository         *repository.FileRepository
+	RabbitMQRepository     *repository.RabbitMQRepository
+	ExchangeRateRepository *repository.ExchangeRateRepository
+	PostgresRepository     *repository.PostgresRepository
+	DataProcessorService   *service.DataProcessorService
+	PythonWorker           *service.PythonWorker
+	FeatureServingService  *service.FeatureServingService
+	Elector                *leader.Elector
+	RabbitMQController     *controller.RabbitMQController
 }
 
 func NewServiceLocator(cfg *config.Config, logger *zap.SugaredLogger) (*ServiceLocator, error) {
-	// Initialize RabbitMQ client
+	locator := &ServiceLocator{
+		Config: cfg,
+		Logger: logger,
+	}
+
+	// Check the pinned virtualenv before any pipeline runs the processor in it
+	if cfg.PythonVirtualenv != "" {
+		if err := service.VerifyVirtualenv(cfg.PythonVirtualenv); err != nil {
+			return nil, err
+		}
+		logger.Infof("Using Python virtualenv %s", cfg.PythonVirtualenv)
+	}
+
+	// Build one set of repositories, services and controllers per pipeline
+	var endpoints []*controller.PipelineEndpoints
+	for _, definition := range cfg.Pipelines {
+		pipeline, err := newPipeline(cfg, definition, logger.With("pipeline", definition.Name))
+		if err != nil {
+			locator.Close()
+			return nil, fmt.Errorf("failed to initialize pipeline %s: %w", definition.Name, err)
+		}
+		locator.Pipelines = append(locator.Pipelines, pipeline)
+		endpoints = append(endpoints, &controller.PipelineEndpoints{
+			Name:                  pipeline.Name,
+			DataProcessorService:  pipeline.DataProcessorService,
+			FeatureServingService: pipeline.FeatureServingService,
+			RabbitMQController:    pipeline.RabbitMQController,
+		})
+	}
+
+	// One HTTP server serves all pipelines
+	locator.HTTPController = controller.NewHTTPController(endpoints, cfg.HTTPAddr, logger)
+
+	return locator, nil
+}
+
+// newPipeline initializes the components of a pipeline, logging with the pipeline's label
+func newPipeline(cfg *config.Config, definition config.PipelineDefinition, logger *zap.SugaredLogger) (*Pipeline, error) {
+	// Load the feature spec that drives processing, the output schema and the loader
+	featureSpec, err := featurespec.Load(definition.FeatureSpecPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the manifests of the external processors chained after the built-in one
+	processors, err := plugin.LoadChain(cfg.PluginsPath, definition.Processors)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the run schedule
+	runSchedule, err := schedule.New(definition.Scheduler.Cron, definition.Scheduler.Timezone, definition.Scheduler.Jitter, definition.Scheduler.Blackouts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize RabbitMQ client, every pipeline consumes on its own connection
 	rabbitClient, err := rabbitmq.NewClient(cfg.RabbitMQURL, logger)
 	if err != nil {
 		return nil, err
 	}
 
 	// Declare queue
-	_, err = rabbitClient.DeclareQueue(cfg.DataQueueName)
+	_, err = rabbitClient.DeclareQueue(definition.QueueName)
 	if err != nil {
 		rabbitClient.Close()
 		return nil, err
 	}
 
-	// Initialize PostgreSQL connection
+	// Initialize PostgreSQL connection, the pipeline's tables live in its own schema
 	connString := fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		cfg.PostgresHost, cfg.PostgresPort, cfg.PostgresUser,
 		cfg.PostgresPassword, cfg.PostgresDBName, cfg.PostgresSSLMode,
 	)
+	if definition.Schema != "" {
+		connString += " search_path=" + definition.Schema
+	}
 
 	var postgresRepo *repository.PostgresRepository
 	postgresRepo, err = repository.NewPostgresRepository(connString, logger)
@@ -53,54 +127,148 @@ func NewServiceLocator(cfg *config.Config, logger *zap.SugaredLogger) (*ServiceL
 		postgresRepo = nil
 	} else {
 		// Run migrations only if connection was successful
-		if err := postgresRepo.RunMigrations(cfg.PostgresDBName); err != nil {
+		if err := ensureSchema(postgresRepo, definition.Schema); err != nil {
+			logger.Warnf("Failed to create schema: %v", err)
+			postgresRepo.Close()
+			postgresRepo = nil
+			logger.Warn("Continuing without PostgreSQL connection, data will only be saved to files")
+		} else if err := postgresRepo.RunMigrations(cfg.PostgresDBName); err != nil {
 			logger.Warnf("Failed to run migrations: %v", err)
 			postgresRepo.Close()
 			postgresRepo = nil
 			logger.Warn("Continuing without PostgreSQL connection, data will only be saved to files")
+		} else if err := postgresRepo.EnsureFeatureColumns(featureSpec.FeatureColumns()); err != nil {
+			logger.Warnf("Failed to apply feature spec columns: %v", err)
+			postgresRepo.Close()
+			postgresRepo = nil
+			logger.Warn("Continuing without PostgreSQL connection, data will only be saved to files")
 		} else {
 			logger.Info("PostgreSQL connection and migrations successful")
 		}
 	}
 
 	// Initialize repositories
-	fileRepo := repository.NewFileRepository(cfg.DataPath)
-	rabbitRepo := repository.NewRabbitMQRepository(rabbitClient, cfg.DataQueueName, logger)
+	fileRepo := repository.NewFileRepository(definition.DataPath)
+	rabbitRepo := repository.NewRabbitMQRepository(rabbitClient, definition.QueueName, logger)
+	exchangeRateRepo := repository.NewExchangeRateRepository(cfg.ExchangeRatesFile, cfg.ExchangeRatesURL, logger)
 
 	// Initialize service
-	scriptPath := filepath.Join(cfg.ScriptsPath, "data_processor.py")
 	dataProcessorService := service.NewDataProcessorService(
 		fileRepo,
 		rabbitRepo,
 		postgresRepo,
+		exchangeRateRepo,
+		featureSpec,
 		cfg.PythonPath,
-		scriptPath,
-		cfg.CutoffDate,
+		definition.ScriptPath,
+		service.ProcessorOptions{
+			CutoffDate:       definition.CutoffDate,
+			Split:            cfg.Split,
+			ProfileTopK:      cfg.ProfileTopK,
+			GapFillEnabled:   cfg.GapFillEnabled,
+			GapFillStrategy:  cfg.GapFillStrategy,
+			CalendarsEnabled: cfg.CalendarsEnabled,
+			CalendarsPath:    cfg.CalendarsPath,
+			CalendarFiles:    cfg.CalendarFiles,
+			RegionCalendars:  cfg.RegionCalendars,
+			BaseCurrency:     cfg.BaseCurrency,
+			Limits:           cfg.ProcessorLimits,
+		},
 		cfg.BatchSize,
 		time.Duration(cfg.ConsumeTimeoutSeconds)*time.Second,
+		cfg.Pipeline,
+		definition.DatasetEvents,
 		logger,
 	)
 
+	if len(processors) > 0 {
+		dataProcessorService.UseProcessors(processors)
+		logger.Infof("Chained processors: %s", strings.Join(definition.Processors, ", "))
+	}
+
+	// Keep a Python worker for the pipeline's processor script instead of a process per run
+	var pythonWorker *service.PythonWorker
+	if cfg.Worker.Enabled {
+		pythonWorker = service.NewPythonWorker(cfg.PythonPath, definition.ScriptPath, cfg.Worker, cfg.ProcessorLimits, logger)
+		if err := pythonWorker.Start(); err != nil {
+			rabbitClient.Close()
+			if postgresRepo != nil {
+				postgresRepo.Close()
+			}
+			return nil, err
+		}
+		dataProcessorService.UseWorker(pythonWorker)
+	}
+
+	// Key processed rows stored before product identity existed
+	if err := dataProcessorService.BackfillProductIDs(); err != nil {
+		logger.Warnf("Failed to backfill product IDs: %v", err)
+	}
+
+	// Serve the latest feature vectors, refreshed after each successful run
+	featureServingService := service.NewFeatureServingService(fileRepo, postgresRepo, featureSpec, logger)
+	if err := featureServingService.Refresh(""); err != nil {
+		logger.Warnf("Failed to load feature cache: %v", err)
+	}
+	dataProcessorService.OnRunCompleted(func(runID string) {
+		if err := featureServingService.Refresh(runID); err != nil {
+			logger.Warnf("Failed to refresh feature cache: %v", err)
+		}
+	})
+
+	// Elect one replica to run the scheduled pipeline, with a file lock when PostgreSQL is absent
+	var elector *leader.Elector
+	if cfg.LeaderElection.Enabled {
+		var lock leader.Lock
+		if postgresRepo != nil {
+			lock = postgresRepo.NewAdvisoryLock(definition.LockKey)
+		} else {
+			lock = repository.NewFileLock(definition.LockFile)
+		}
+		elector = leader.NewElector(lock, cfg.LeaderElection.CheckInterval, logger)
+	}
+
 	// Initialize controller
-	rabbitMQController := controller.NewRabbitMQController(dataProcessorService, logger)
-
-	return &ServiceLocator{
-		Config:               cfg,
-		RabbitClient:         rabbitClient,
-		Logger:               logger,
-		FileRepository:       fileRepo,
-		RabbitMQRepository:   rabbitRepo,
-		PostgresRepository:   postgresRepo,
-		DataProcessorService: dataProcessorService,
-		RabbitMQController:   rabbitMQController,
+	rabbitMQController := controller.NewRabbitMQController(dataProcessorService, runSchedule, elector, definition.QueueTrigger, definition.Scheduler.RunOnStart, logger)
+
+	return &Pipeline{
+		Name:                   definition.Name,
+		RabbitClient:           rabbitClient,
+		FileRepository:         fileRepo,
+		RabbitMQRepository:     rabbitRepo,
+		ExchangeRateRepository: exchangeRateRepo,
+		PostgresRepository:     postgresRepo,
+		DataProcessorService:   dataProcessorService,
+		PythonWorker:           pythonWorker,
+		FeatureServingService:  featureServingService,
+		Elector:                elector,
+		RabbitMQController:     rabbitMQController,
 	}, nil
 }
 
+// ensureSchema creates the pipeline's schema, the default search path needs none
+func ensureSchema(postgresRepo *repository.PostgresRepository, schema string) error {
+	if schema == "" {
+		return nil
+	}
+	return postgresRepo.EnsureSchema(schema)
+}
+
 func (l *ServiceLocator) Close() {
-	if l.RabbitClient != nil {
-		l.RabbitClient.Close()
+	for _, p := range l.Pipelines {
+		p.Close()
+	}
+}
+
+// Close stops the pipeline's Python worker and closes its RabbitMQ and PostgreSQL connections
+func (p *Pipeline) Close() {
+	if p.PythonWorker != nil {
+		p.PythonWorker.Close()
+	}
+	if p.RabbitClient != nil {
+		p.RabbitClient.Close()
 	}
-	if l.PostgresRepository != nil {
-		l.PostgresRepository.Close()
+	if p.PostgresRepository != nil {
+		p.PostgresRepository.Close()
 	}
 }
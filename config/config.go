@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,12 +13,38 @@ type Config struct {
 	RabbitMQURL           string
 	DataQueueName         string
 	SchedulerInterval     time.Duration
+	Scheduler             SchedulerConfig
+	QueueTrigger          QueueTriggerConfig
 	DataPath              string
 	ScriptsPath           string
 	PythonPath            string
+	PythonVirtualenv      string
+	Worker                WorkerConfig
+	PluginsPath           string
+	ProcessorChain        []string
 	CutoffDate            string
+	Split                 SplitConfig
 	BatchSize             int
 	ConsumeTimeoutSeconds int
+	ProfileTopK           int
+	GapFillEnabled        bool
+	GapFillStrategy       string
+	CalendarsEnabled      bool
+	CalendarsPath         string
+	CalendarFiles         []string
+	RegionCalendars       string
+	BaseCurrency          string
+	ProcessorLimits       ProcessorLimits
+	ExchangeRatesFile     string
+	ExchangeRatesURL      string
+	FeatureSpecPath       string
+	HTTPAddr              string
+	LeaderElection        LeaderElectionConfig
+	ShutdownGracePeriod   time.Duration
+	Pipeline              PipelineConfig
+	DatasetEvents         DatasetEventsConfig
+	// Pipelines are read from PIPELINES_FILE, without it the single pipeline configured above runs
+	Pipelines []PipelineDefinition
 	// PostgreSQL configuration
 	PostgresHost     string
 	PostgresPort     string
@@ -26,6 +54,108 @@ type Config struct {
 	PostgresSSLMode  string
 }
 
+// SchedulerConfig describes when the pipeline runs
+type SchedulerConfig struct {
+	// Cron is a five-field cron expression or a descriptor such as @daily
+	Cron       string
+	Timezone   string
+	Jitter     time.Duration
+	Blackouts  string
+	RunOnStart bool
+}
+
+// ProcessorLimits bound the external processor, zero values disable a limit
+type ProcessorLimits struct {
+	// MaxRuntime ends the processor step, the transform stage timeout still applies without it
+	MaxRuntime time.Duration
+	// MaxAddressSpaceMB and MaxCPUSeconds are applied as resource limits on Linux
+	MaxAddressSpaceMB int
+	MaxCPUSeconds     int
+}
+
+// WorkerConfig selects whether the Python processor runs as a long-lived worker
+type WorkerConfig struct {
+	// Enabled keeps one worker per pipeline instead of starting a process for every run
+	Enabled bool
+	// ScriptPath is the worker script, it imports the pipeline's processor script
+	ScriptPath     string
+	HealthInterval time.Duration
+	HealthTimeout  time.Duration
+}
+
+// QueueTriggerConfig starts runs between planned runs when a backlog builds up in the queue
+type QueueTriggerConfig struct {
+	// Threshold is the queue depth that starts a run, 0 disables it
+	Threshold int
+	// MaxAge is the age of the oldest message that starts a run, 0 disables it
+	MaxAge       time.Duration
+	PollInterval time.Duration
+}
+
+// Enabled reports whether the queue is inspected between planned runs
+func (c QueueTriggerConfig) Enabled() bool {
+	return c.Threshold > 0 || c.MaxAge > 0
+}
+
+// LeaderElectionConfig makes sure only one replica runs the scheduled pipeline
+type LeaderElectionConfig struct {
+	Enabled bool
+	// LockKey is the PostgreSQL advisory lock key
+	LockKey int64
+	// LockFile is flocked when PostgreSQL is not available
+	LockFile      string
+	CheckInterval time.Duration
+}
+
+// PipelineStages are the pipeline stages in execution order
+var PipelineStages = []string{"consume", "archive", "transform", "validate", "load", "publish"}
+
+// PipelineConfig holds the timeout and retry policy of every pipeline stage
+type PipelineConfig struct {
+	Stages map[string]StagePolicy
+	// ResumeAttempts is how many times a failed run is resumed before it is abandoned, at least 1.
+	// Later runs wait for a failed run, so it must not be resumed forever.
+	ResumeAttempts int
+}
+
+// DatasetEventsConfig selects where "dataset ready" events are published
+type DatasetEventsConfig struct {
+	Enabled bool
+	// Pipeline names the pipeline in the events
+	Pipeline string
+	// Exchange is empty for the default exchange, then RoutingKey is the queue name
+	Exchange   string
+	RoutingKey string
+}
+
+// StagePolicy bounds a single pipeline stage
+type StagePolicy struct {
+	Timeout time.Duration
+	// Attempts is the number of tries before the stage fails the run
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for every next one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// SplitConfig selects how processed data is split into training, validation and test sets
+type SplitConfig struct {
+	Strategy        string
+	TestDays        int
+	ValidationDays  int
+	Folds           int
+	FoldDays        int
+	TrainDays       int
+	GapDays         int
+	HoldoutFraction float64
+}
+
+// splitStrategies are the supported split strategies
+var splitStrategies = map[string]bool{
+	"cutoff": true, "relative": true, "three_way": true,
+	"rolling": true, "expanding": true, "product_holdout": true,
+}
+
 func New() (*Config, error) {
 	rabbitMQURL := os.Getenv("RABBITMQ_URL")
 	if rabbitMQURL == "" {
@@ -46,6 +176,47 @@ func New() (*Config, error) {
 		}
 	}
 
+	// Cron schedule; without it the pipeline runs every SCHEDULER_INTERVAL_HOURS from startup
+	scheduler := SchedulerConfig{
+		Cron:      os.Getenv("SCHEDULER_CRON"),
+		Timezone:  os.Getenv("SCHEDULER_TIMEZONE"),
+		Blackouts: os.Getenv("SCHEDULER_BLACKOUT_WINDOWS"),
+	}
+	if scheduler.Cron == "" {
+		scheduler.Cron = fmt.Sprintf("@every %s", schedulerInterval)
+	}
+	if scheduler.Timezone == "" {
+		scheduler.Timezone = "UTC"
+	}
+	if jitterStr := os.Getenv("SCHEDULER_JITTER"); jitterStr != "" {
+		jitter, err := time.ParseDuration(jitterStr)
+		if err != nil || jitter < 0 {
+			return nil, fmt.Errorf("invalid SCHEDULER_JITTER %q", jitterStr)
+		}
+		scheduler.Jitter = jitter
+	}
+	// By default only the interval schedule runs immediately on startup
+	scheduler.RunOnStart = os.Getenv("SCHEDULER_CRON") == ""
+	if runOnStartStr := os.Getenv("SCHEDULER_RUN_ON_START"); runOnStartStr != "" {
+		runOnStart, err := strconv.ParseBool(runOnStartStr)
+		if err == nil {
+			scheduler.RunOnStart = runOnStart
+		}
+	}
+
+	// Queue-depth triggered runs, the schedule remains the upper bound between runs
+	queueTrigger := QueueTriggerConfig{
+		Threshold:    intEnv("QUEUE_TRIGGER_THRESHOLD", 0, 0),
+		PollInterval: time.Duration(intEnv("QUEUE_POLL_INTERVAL_SECONDS", 30, 1)) * time.Second,
+	}
+	if maxAgeStr := os.Getenv("QUEUE_TRIGGER_MAX_AGE"); maxAgeStr != "" {
+		maxAge, err := time.ParseDuration(maxAgeStr)
+		if err != nil || maxAge < 0 {
+			return nil, fmt.Errorf("invalid QUEUE_TRIGGER_MAX_AGE %q", maxAgeStr)
+		}
+		queueTrigger.MaxAge = maxAge
+	}
+
 	dataPath := os.Getenv("DATA_PATH")
 	if dataPath == "" {
 		dataPath = "./data"
@@ -63,11 +234,70 @@ func New() (*Config, error) {
 		pythonPath = "python"
 	}
 
+	// A virtualenv replaces PYTHON_PATH with its own interpreter
+	pythonVirtualenv := os.Getenv("PYTHON_VIRTUALENV")
+	if pythonVirtualenv != "" {
+		pythonVirtualenv, _ = filepath.Abs(pythonVirtualenv)
+		pythonPath = filepath.Join(pythonVirtualenv, "bin", "python")
+	}
+
+	// Run the processor in a long-lived worker or as a new process per run
+	worker := WorkerConfig{
+		ScriptPath:     filepath.Join(scriptsPath, "worker.py"),
+		HealthInterval: time.Duration(intEnv("WORKER_HEALTH_INTERVAL_SECONDS", 30, 1)) * time.Second,
+		HealthTimeout:  time.Duration(intEnv("WORKER_HEALTH_TIMEOUT_SECONDS", 10, 1)) * time.Second,
+	}
+	// External processors chained after the built-in one, in order
+	pluginsPath := os.Getenv("PROCESSOR_PLUGINS_PATH")
+	if pluginsPath == "" {
+		pluginsPath = filepath.Join(scriptsPath, "processors")
+	}
+	var processorChain []string
+	for _, name := range strings.Split(os.Getenv("PROCESSOR_CHAIN"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			processorChain = append(processorChain, name)
+		}
+	}
+
+	switch mode := os.Getenv("PROCESSOR_MODE"); mode {
+	case "", "process":
+	case "worker":
+		worker.Enabled = true
+	default:
+		return nil, fmt.Errorf("unknown PROCESSOR_MODE %q", mode)
+	}
+
 	cutoffDate := os.Getenv("CUTOFF_DATE")
 	if cutoffDate == "" {
 		cutoffDate = "2025-03-20"
 	}
 
+	// Split strategy: cutoff (fixed CUTOFF_DATE), relative (last N days), three_way,
+	// rolling or expanding cross-validation folds, or product_holdout
+	split := SplitConfig{
+		Strategy:        os.Getenv("SPLIT_STRATEGY"),
+		TestDays:        intEnv("SPLIT_TEST_DAYS", 30, 1),
+		ValidationDays:  intEnv("SPLIT_VALIDATION_DAYS", 30, 1),
+		Folds:           intEnv("SPLIT_FOLDS", 5, 1),
+		FoldDays:        intEnv("SPLIT_FOLD_DAYS", 30, 1),
+		TrainDays:       intEnv("SPLIT_TRAIN_DAYS", 180, 1),
+		GapDays:         intEnv("SPLIT_GAP_DAYS", 0, 0),
+		HoldoutFraction: 0.2,
+	}
+	if split.Strategy == "" {
+		split.Strategy = "cutoff"
+	}
+	if !splitStrategies[split.Strategy] {
+		return nil, fmt.Errorf("unknown SPLIT_STRATEGY %q", split.Strategy)
+	}
+	if fractionStr := os.Getenv("SPLIT_HOLDOUT_FRACTION"); fractionStr != "" {
+		fraction, err := strconv.ParseFloat(fractionStr, 64)
+		if err != nil || fraction <= 0 || fraction >= 1 {
+			return nil, fmt.Errorf("SPLIT_HOLDOUT_FRACTION must be between 0 and 1, got %q", fractionStr)
+		}
+		split.HoldoutFraction = fraction
+	}
+
 	batchSizeStr := os.Getenv("BATCH_SIZE")
 	batchSize := 1000 // Default batch size
 	if batchSizeStr != "" {
@@ -86,6 +316,149 @@ func New() (*Config, error) {
 		}
 	}
 
+	profileTopKStr := os.Getenv("PROFILE_TOP_K")
+	profileTopK := 10 // Default number of top categorical values in the dataset profile
+	if profileTopKStr != "" {
+		topK, err := strconv.Atoi(profileTopKStr)
+		if err == nil && topK > 0 {
+			profileTopK = topK
+		}
+	}
+
+	gapFillEnabled := true // Default: reindex series onto a continuous daily calendar
+	if gapFillEnabledStr := os.Getenv("GAP_FILL_ENABLED"); gapFillEnabledStr != "" {
+		enabled, err := strconv.ParseBool(gapFillEnabledStr)
+		if err == nil {
+			gapFillEnabled = enabled
+		}
+	}
+
+	// Fill strategies per field, e.g. "sales_quantity=zero,price=ffill,stock_level=interpolate"
+	gapFillStrategy := os.Getenv("GAP_FILL_STRATEGY")
+
+	calendarsEnabled := true // Default: compute is_weekend/is_holiday from bundled calendars
+	if calendarsEnabledStr := os.Getenv("HOLIDAY_CALENDARS_ENABLED"); calendarsEnabledStr != "" {
+		enabled, err := strconv.ParseBool(calendarsEnabledStr)
+		if err == nil {
+			calendarsEnabled = enabled
+		}
+	}
+
+	calendarsPath := os.Getenv("HOLIDAY_CALENDARS_PATH")
+	if calendarsPath == "" {
+		calendarsPath = filepath.Join(scriptsPath, "calendars")
+	}
+
+	// Custom calendar files, comma-separated
+	var calendarFiles []string
+	for _, file := range strings.Split(os.Getenv("HOLIDAY_CALENDAR_FILES"), ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			calendarFiles = append(calendarFiles, file)
+		}
+	}
+
+	// Region to calendar mapping, e.g. "default=ru,Минск=by"
+	regionCalendars := os.Getenv("REGION_CALENDARS")
+	if regionCalendars == "" {
+		regionCalendars = "default=ru"
+	}
+
+	baseCurrency := strings.ToUpper(os.Getenv("BASE_CURRENCY"))
+	if baseCurrency == "" {
+		baseCurrency = "RUB"
+	}
+
+	// Exchange rate sources: a CSV file and/or an HTTP endpoint returning JSON
+	exchangeRatesFile := os.Getenv("EXCHANGE_RATES_FILE")
+	exchangeRatesURL := os.Getenv("EXCHANGE_RATES_URL")
+
+	featureSpecPath := os.Getenv("FEATURE_SPEC_PATH")
+	if featureSpecPath == "" {
+		featureSpecPath = "specs/feature_spec.yaml"
+	}
+
+	// Address of the HTTP server serving feature vectors to the ML service
+	httpAddr := os.Getenv("HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = ":8080"
+	}
+
+	// Leader election between replicas
+	leaderElection := LeaderElectionConfig{
+		Enabled:       false,
+		LockKey:       727100,
+		LockFile:      os.Getenv("LEADER_LOCK_FILE"),
+		CheckInterval: time.Duration(intEnv("LEADER_CHECK_INTERVAL_SECONDS", 10, 1)) * time.Second,
+	}
+	if enabledStr := os.Getenv("LEADER_ELECTION_ENABLED"); enabledStr != "" {
+		enabled, err := strconv.ParseBool(enabledStr)
+		if err == nil {
+			leaderElection.Enabled = enabled
+		}
+	}
+	if keyStr := os.Getenv("LEADER_LOCK_KEY"); keyStr != "" {
+		key, err := strconv.ParseInt(keyStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LEADER_LOCK_KEY %q", keyStr)
+		}
+		leaderElection.LockKey = key
+	}
+	if leaderElection.LockFile == "" {
+		leaderElection.LockFile = filepath.Join(dataPath, "leader.lock")
+	}
+
+	// How long a running pipeline may finish on shutdown before it is cancelled
+	shutdownGracePeriod := time.Duration(intEnv("SHUTDOWN_GRACE_PERIOD_SECONDS", 60, 0)) * time.Second
+
+	// Hard limits of the Python processor
+	processorLimits := ProcessorLimits{
+		MaxRuntime:        time.Duration(intEnv("PROCESSOR_MAX_RUNTIME_SECONDS", 0, 0)) * time.Second,
+		MaxAddressSpaceMB: intEnv("PROCESSOR_MAX_ADDRESS_SPACE_MB", 0, 0),
+		MaxCPUSeconds:     intEnv("PROCESSOR_MAX_CPU_SECONDS", 0, 0),
+	}
+
+	// Stage timeouts and retries, PIPELINE_<STAGE>_* overrides the defaults for one stage
+	pipeline := PipelineConfig{
+		Stages:         make(map[string]StagePolicy, len(PipelineStages)),
+		ResumeAttempts: intEnv("PIPELINE_RESUME_ATTEMPTS", 3, 1),
+	}
+	retryAttempts := intEnv("PIPELINE_RETRY_ATTEMPTS", 3, 1)
+	retryBackoff := intEnv("PIPELINE_RETRY_BACKOFF_SECONDS", 5, 0)
+	retryMaxBackoff := intEnv("PIPELINE_RETRY_MAX_BACKOFF_SECONDS", 300, 0)
+	stageTimeouts := map[string]int{
+		"consume":   consumeTimeout + 60,
+		"transform": 3600,
+	}
+	for _, stage := range PipelineStages {
+		prefix := "PIPELINE_" + strings.ToUpper(stage)
+		timeout, ok := stageTimeouts[stage]
+		if !ok {
+			timeout = 600
+		}
+		pipeline.Stages[stage] = StagePolicy{
+			Timeout:    time.Duration(intEnv(prefix+"_TIMEOUT_SECONDS", timeout, 1)) * time.Second,
+			Attempts:   intEnv(prefix+"_ATTEMPTS", retryAttempts, 1),
+			Backoff:    time.Duration(retryBackoff) * time.Second,
+			MaxBackoff: time.Duration(retryMaxBackoff) * time.Second,
+		}
+	}
+
+	// "Dataset ready" events for the ML service
+	datasetEvents := DatasetEventsConfig{
+		Enabled:    false,
+		Exchange:   os.Getenv("DATASET_EVENTS_EXCHANGE"),
+		RoutingKey: os.Getenv("DATASET_EVENTS_ROUTING_KEY"),
+	}
+	if enabledStr := os.Getenv("DATASET_EVENTS_ENABLED"); enabledStr != "" {
+		enabled, err := strconv.ParseBool(enabledStr)
+		if err == nil {
+			datasetEvents.Enabled = enabled
+		}
+	}
+	if datasetEvents.RoutingKey == "" {
+		datasetEvents.RoutingKey = "dataset_ready"
+	}
+
 	// PostgreSQL configuration
 	postgresHost := os.Getenv("POSTGRES_HOST")
 	if postgresHost == "" {
@@ -117,21 +490,63 @@ func New() (*Config, error) {
 		postgresSSLMode = "disable"
 	}
 
-	return &Config{
+	cfg := &Config{
 		RabbitMQURL:           rabbitMQURL,
 		DataQueueName:         dataQueueName,
 		SchedulerInterval:     schedulerInterval,
+		Scheduler:             scheduler,
+		QueueTrigger:          queueTrigger,
 		DataPath:              dataPath,
 		ScriptsPath:           scriptsPath,
 		PythonPath:            pythonPath,
+		PythonVirtualenv:      pythonVirtualenv,
+		Worker:                worker,
+		PluginsPath:           pluginsPath,
+		ProcessorChain:        processorChain,
 		CutoffDate:            cutoffDate,
+		Split:                 split,
 		BatchSize:             batchSize,
 		ConsumeTimeoutSeconds: consumeTimeout,
+		ProfileTopK:           profileTopK,
+		GapFillEnabled:        gapFillEnabled,
+		GapFillStrategy:       gapFillStrategy,
+		CalendarsEnabled:      calendarsEnabled,
+		CalendarsPath:         calendarsPath,
+		CalendarFiles:         calendarFiles,
+		RegionCalendars:       regionCalendars,
+		BaseCurrency:          baseCurrency,
+		ProcessorLimits:       processorLimits,
+		ExchangeRatesFile:     exchangeRatesFile,
+		ExchangeRatesURL:      exchangeRatesURL,
+		FeatureSpecPath:       featureSpecPath,
+		HTTPAddr:              httpAddr,
+		LeaderElection:        leaderElection,
+		ShutdownGracePeriod:   shutdownGracePeriod,
+		Pipeline:              pipeline,
+		DatasetEvents:         datasetEvents,
 		PostgresHost:          postgresHost,
 		PostgresPort:          postgresPort,
 		PostgresUser:          postgresUser,
 		PostgresPassword:      postgresPassword,
 		PostgresDBName:        postgresDBName,
 		PostgresSSLMode:       postgresSSLMode,
-	}, nil
+	}
+
+	pipelines, err := cfg.loadPipelines(os.Getenv("PIPELINES_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Pipelines = pipelines
+
+	return cfg, nil
+}
+
+// intEnv reads an integer environment variable, falling back to def when it is unset,
+// invalid or below min
+func intEnv(name string, def int, min int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < min {
+		return def
+	}
+	return value
 }
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPipelineName names the single pipeline configured from the environment
+const DefaultPipelineName = "default"
+
+// pipelineNamePattern keeps pipeline names usable in URLs, paths and PostgreSQL schema names
+var pipelineNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// PipelineDefinition holds the settings of one pipeline. Settings missing from PIPELINES_FILE
+// are taken from the environment.
+type PipelineDefinition struct {
+	Name            string
+	QueueName       string
+	DataPath        string
+	ScriptPath      string
+	CutoffDate      string
+	FeatureSpecPath string
+	// Processors are the external processors chained after ScriptPath, in order
+	Processors []string
+	// Schema is the PostgreSQL schema of the pipeline's tables, empty for the default search path
+	Schema        string
+	Scheduler     SchedulerConfig
+	QueueTrigger  QueueTriggerConfig
+	DatasetEvents DatasetEventsConfig
+	LockKey       int64
+	LockFile      string
+}
+
+// pipelinesFile is the layout of PIPELINES_FILE
+type pipelinesFile struct {
+	Pipelines []pipelineEntry `yaml:"pipelines"`
+}
+
+// pipelineEntry is a pipeline in PIPELINES_FILE, unset fields keep the environment defaults
+type pipelineEntry struct {
+	Name        string `yaml:"name"`
+	Queue       string `yaml:"queue"`
+	DataPath    string `yaml:"data_path"`
+	Script      string `yaml:"script"`
+	CutoffDate  string `yaml:"cutoff_date"`
+	FeatureSpec string `yaml:"feature_spec"`
+	Schema      string `yaml:"schema"`
+	Schedule    *struct {
+		Cron            string `yaml:"cron"`
+		Timezone        string `yaml:"timezone"`
+		Jitter          string `yaml:"jitter"`
+		BlackoutWindows string `yaml:"blackout_windows"`
+		RunOnStart      *bool  `yaml:"run_on_start"`
+	} `yaml:"schedule"`
+	QueueTrigger *struct {
+		Threshold           *int   `yaml:"threshold"`
+		MaxAge              string `yaml:"max_age"`
+		PollIntervalSeconds *int   `yaml:"poll_interval_seconds"`
+	} `yaml:"queue_trigger"`
+	Events *struct {
+		Enabled    *bool   `yaml:"enabled"`
+		Exchange   *string `yaml:"exchange"`
+		RoutingKey string  `yaml:"routing_key"`
+	} `yaml:"events"`
+	LeaderLockKey *int64 `yaml:"leader_lock_key"`
+	// Processors replaces PROCESSOR_CHAIN, an empty list runs no external processors
+	Processors *[]string `yaml:"processors"`
+}
+
+// defaultPipeline builds the pipeline configured by the environment variables alone
+func (c *Config) defaultPipeline() PipelineDefinition {
+	return PipelineDefinition{
+		Name:            DefaultPipelineName,
+		QueueName:       c.DataQueueName,
+		DataPath:        c.DataPath,
+		ScriptPath:      filepath.Join(c.ScriptsPath, "data_processor.py"),
+		CutoffDate:      c.CutoffDate,
+		FeatureSpecPath: c.FeatureSpecPath,
+		Processors:      c.ProcessorChain,
+		Scheduler:       c.Scheduler,
+		QueueTrigger:    c.QueueTrigger,
+		DatasetEvents:   c.datasetEventsFor(DefaultPipelineName),
+		LockKey:         c.LeaderElection.LockKey,
+		LockFile:        c.LeaderElection.LockFile,
+	}
+}
+
+// datasetEventsFor returns the dataset event settings naming a pipeline
+func (c *Config) datasetEventsFor(name string) DatasetEventsConfig {
+	events := c.DatasetEvents
+	events.Pipeline = name
+	return events
+}
+
+// loadPipelines reads the pipeline list from path, or returns the default pipeline when path is empty
+func (c *Config) loadPipelines(path string) ([]PipelineDefinition, error) {
+	if path == "" {
+		return []PipelineDefinition{c.defaultPipeline()}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipelines file: %w", err)
+	}
+
+	var file pipelinesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse pipelines file %s: %w", path, err)
+	}
+	if len(file.Pipelines) == 0 {
+		return nil, fmt.Errorf("pipelines file %s defines no pipelines", path)
+	}
+
+	pipelines := make([]PipelineDefinition, 0, len(file.Pipelines))
+	seen := map[string]map[string]string{"name": {}, "queue": {}, "data_path": {}, "schema": {}, "leader_lock_key": {}}
+	for i, entry := range file.Pipelines {
+		p, err := c.pipelineFromEntry(i, entry)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %d (%s): %w", i+1, entry.Name, err)
+		}
+
+		// Pipelines sharing a queue, directory or tables would consume or overwrite each other's data,
+		// and pipelines sharing a lock key would let only one of them run
+		for field, value := range map[string]string{
+			"name":            p.Name,
+			"queue":           p.QueueName,
+			"data_path":       filepath.Clean(p.DataPath),
+			"schema":          p.Schema,
+			"leader_lock_key": strconv.FormatInt(p.LockKey, 10),
+		} {
+			if other, ok := seen[field][value]; ok {
+				return nil, fmt.Errorf("pipelines %s and %s use the same %s %q", other, p.Name, field, value)
+			}
+			seen[field][value] = p.Name
+		}
+
+		pipelines = append(pipelines, p)
+	}
+
+	return pipelines, nil
+}
+
+// pipelineFromEntry applies a PIPELINES_FILE entry to the environment defaults
+func (c *Config) pipelineFromEntry(index int, entry pipelineEntry) (PipelineDefinition, error) {
+	if !pipelineNamePattern.MatchString(entry.Name) {
+		return PipelineDefinition{}, fmt.Errorf("name must match %s", pipelineNamePattern)
+	}
+
+	p := c.defaultPipeline()
+	p.Name = entry.Name
+	p.DatasetEvents = c.datasetEventsFor(entry.Name)
+	p.DataPath = filepath.Join(c.DataPath, entry.Name)
+	p.Schema = entry.Name
+	p.LockKey = c.LeaderElection.LockKey + int64(index)
+
+	if entry.Queue != "" {
+		p.QueueName = entry.Queue
+	}
+	if entry.DataPath != "" {
+		p.DataPath = entry.DataPath
+	}
+	if entry.Script != "" {
+		p.ScriptPath = entry.Script
+	}
+	if entry.CutoffDate != "" {
+		p.CutoffDate = entry.CutoffDate
+	}
+	if entry.FeatureSpec != "" {
+		p.FeatureSpecPath = entry.FeatureSpec
+	}
+	if entry.Schema != "" {
+		p.Schema = entry.Schema
+	}
+	if entry.Processors != nil {
+		p.Processors = *entry.Processors
+	}
+	if !pipelineNamePattern.MatchString(p.Schema) {
+		return PipelineDefinition{}, fmt.Errorf("schema must match %s", pipelineNamePattern)
+	}
+	if entry.LeaderLockKey != nil {
+		p.LockKey = *entry.LeaderLockKey
+	}
+	p.LockFile = filepath.Join(p.DataPath, "leader.lock")
+
+	if s := entry.Schedule; s != nil {
+		if s.Cron != "" {
+			p.Scheduler.Cron = s.Cron
+			// Like SCHEDULER_CRON, a cron expression does not run on startup unless asked to
+			p.Scheduler.RunOnStart = false
+		}
+		if s.Timezone != "" {
+			p.Scheduler.Timezone = s.Timezone
+		}
+		if s.Jitter != "" {
+			jitter, err := time.ParseDuration(s.Jitter)
+			if err != nil || jitter < 0 {
+				return PipelineDefinition{}, fmt.Errorf("invalid schedule jitter %q", s.Jitter)
+			}
+			p.Scheduler.Jitter = jitter
+		}
+		if s.BlackoutWindows != "" {
+			p.Scheduler.Blackouts = s.BlackoutWindows
+		}
+		if s.RunOnStart != nil {
+			p.Scheduler.RunOnStart = *s.RunOnStart
+		}
+	}
+
+	if t := entry.QueueTrigger; t != nil {
+		if t.Threshold != nil {
+			p.QueueTrigger.Threshold = *t.Threshold
+		}
+		if t.MaxAge != "" {
+			maxAge, err := time.ParseDuration(t.MaxAge)
+			if err != nil || maxAge < 0 {
+				return PipelineDefinition{}, fmt.Errorf("invalid queue trigger max_age %q", t.MaxAge)
+			}
+			p.QueueTrigger.MaxAge = maxAge
+		}
+		if t.PollIntervalSeconds != nil && *t.PollIntervalSeconds > 0 {
+			p.QueueTrigger.PollInterval = time.Duration(*t.PollIntervalSeconds) * time.Second
+		}
+	}
+
+	if e := entry.Events; e != nil {
+		if e.Enabled != nil {
+			p.DatasetEvents.Enabled = *e.Enabled
+		}
+		if e.Exchange != nil {
+			p.DatasetEvents.Exchange = *e.Exchange
+		}
+		if e.RoutingKey != "" {
+			p.DatasetEvents.RoutingKey = e.RoutingKey
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// maxFeatureKeys limits the number of series requested at once
+const maxFeatureKeys = 1000
+
+// shutdownTimeout is the time given to in-flight HTTP requests on shutdown
+const shutdownTimeout = 5 * time.Second
+
+// featuresRequest is the body of a feature lookup
+type featuresRequest struct {
+	Keys []repository.FeatureKey `json:"keys"`
+}
+
+// featuresResponse is the result of a feature lookup
+type featuresResponse struct {
+	Cache    service.FeatureCacheStatus `json:"cache"`
+	Features []repository.FeatureVector `json:"features"`
+	Missing  []repository.FeatureKey    `json:"missing"`
+}
+
+// PipelineEndpoints are the services of one pipeline served over HTTP
+type PipelineEndpoints struct {
+	Name                  string
+	DataProcessorService  *service.DataProcessorService
+	FeatureServingService *service.FeatureServingService
+	RabbitMQController    *RabbitMQController
+}
+
+// pipelineStatus summarizes a pipeline in the pipeline list
+type pipelineStatus struct {
+	Name      string                     `json:"name"`
+	Scheduler SchedulerStatus            `json:"scheduler"`
+	Features  service.FeatureCacheStatus `json:"features"`
+}
+
+// pipelineHandler handles a request for a resolved pipeline
+type pipelineHandler func(w http.ResponseWriter, r *http.Request, p *PipelineEndpoints)
+
+// HTTPController serves feature vectors and dataset exports to the ML service over HTTP
+type HTTPController struct {
+	pipelines []*PipelineEndpoints
+	byName    map[string]*PipelineEndpoints
+	addr      string
+	logger    *zap.SugaredLogger
+}
+
+// NewHTTPController creates a new HTTPController instance. Unprefixed routes serve the first pipeline.
+func NewHTTPController(
+	pipelines []*PipelineEndpoints,
+	addr string,
+	logger *zap.SugaredLogger,
+) *HTTPController {
+	byName := make(map[string]*PipelineEndpoints, len(pipelines))
+	for _, p := range pipelines {
+		byName[p.Name] = p
+	}
+	return &HTTPController{
+		pipelines: pipelines,
+		byName:    byName,
+		addr:      addr,
+		logger:    logger,
+	}
+}
+
+// Start starts the HTTP server and stops it when the context is cancelled
+func (c *HTTPController) Start(ctx context.Context) {
+	mux := http.NewServeMux()
+	c.handlePipeline(mux, "POST", "/features", c.handleFeatures)
+	c.handlePipeline(mux, "GET", "/features/status", c.handleStatus)
+	c.handlePipeline(mux, "GET", "/datasets/as-of", c.handleDatasetAsOf)
+	c.handlePipeline(mux, "GET", "/artifacts/encoders", c.handleEncoders)
+	c.handlePipeline(mux, "GET", "/artifacts/scalers", c.handleScalers)
+	c.handlePipeline(mux, "GET", "/scheduler/status", c.handleSchedulerStatus)
+	c.handlePipeline(mux, "GET", "/runs/{run_id}", c.handleRun)
+	mux.HandleFunc("GET /pipelines", c.handlePipelines)
+	mux.HandleFunc("GET /metrics", c.handleMetrics)
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{Addr: c.addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		c.logger.Infof("Starting HTTP controller on %s", c.addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Errorf("HTTP server failed: %v", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			c.logger.Warnf("Failed to shut down HTTP server: %v", err)
+		}
+		c.logger.Info("HTTP controller stopped")
+	}()
+}
+
+// handlePipeline registers a route for the first pipeline and under /pipelines/{pipeline} for every pipeline
+func (c *HTTPController) handlePipeline(mux *http.ServeMux, method string, path string, handler pipelineHandler) {
+	mux.HandleFunc(method+" "+path, func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, c.pipelines[0])
+	})
+	mux.HandleFunc(method+" /pipelines/{pipeline}"+path, func(w http.ResponseWriter, r *http.Request) {
+		p, ok := c.byName[r.PathValue("pipeline")]
+		if !ok {
+			c.writeError(w, http.StatusNotFound, fmt.Sprintf("unknown pipeline %q", r.PathValue("pipeline")))
+			return
+		}
+		handler(w, r, p)
+	})
+}
+
+// handlePipelines lists the pipelines with their scheduler and feature cache state
+func (c *HTTPController) handlePipelines(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]pipelineStatus, 0, len(c.pipelines))
+	for _, p := range c.pipelines {
+		statuses = append(statuses, pipelineStatus{
+			Name:      p.Name,
+			Scheduler: p.RabbitMQController.Status(),
+			Features:  p.FeatureServingService.Status(),
+		})
+	}
+	c.writeJSON(w, http.StatusOK, statuses)
+}
+
+// handleFeatures returns the latest feature vectors for a list of (product_id, region) keys
+func (c *HTTPController) handleFeatures(w http.ResponseWriter, r *http.Request, p *PipelineEndpoints) {
+	var req featuresRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		c.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if len(req.Keys) == 0 {
+		c.writeError(w, http.StatusBadRequest, "no keys requested")
+		return
+	}
+	if len(req.Keys) > maxFeatureKeys {
+		c.writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d keys can be requested at once", maxFeatureKeys))
+		return
+	}
+
+	features, missing := p.FeatureServingService.GetFeatures(req.Keys)
+	if missing == nil {
+		missing = []repository.FeatureKey{}
+	}
+
+	c.writeJSON(w, http.StatusOK, featuresResponse{
+		Cache:    p.FeatureServingService.Status(),
+		Features: features,
+		Missing:  missing,
+	})
+}
+
+// handleStatus reports the state of the feature cache
+func (c *HTTPController) handleStatus(w http.ResponseWriter, r *http.Request, p *PipelineEndpoints) {
+	c.writeJSON(w, http.StatusOK, p.FeatureServingService.Status())
+}
+
+// handleDatasetAsOf streams the processed dataset as it was known at the as_of timestamp as CSV
+func (c *HTTPController) handleDatasetAsOf(w http.ResponseWriter, r *http.Request, p *PipelineEndpoints) {
+	asOf, err := time.Parse(time.RFC3339, r.URL.Query().Get("as_of"))
+	if err != nil {
+		c.writeError(w, http.StatusBadRequest, "as_of must be an RFC 3339 timestamp")
+		return
+	}
+
+	dataType := r.URL.Query().Get("data_type")
+	if dataType != "" && dataType != "train" && dataType != "validation" && dataType != "test" {
+		c.writeError(w, http.StatusBadRequest, "data_type must be train, validation or test")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("dataset_asof_%s.csv", asOf.UTC().Format("20060102_150405"))))
+
+	body := &trackingWriter{ResponseWriter: w}
+	if _, err := p.DataProcessorService.ExportDatasetAsOf(body, asOf, dataType); err != nil {
+		c.logger.Errorf("Failed to export dataset as of %s: %v", asOf.Format(time.RFC3339), err)
+		// Once part of the CSV is written the error can only be logged
+		if body.written {
+			return
+		}
+		if errors.Is(err, service.ErrDatabaseUnavailable) {
+			c.writeError(w, http.StatusServiceUnavailable, err.Error())
+		} else {
+			c.writeError(w, http.StatusInternalServerError, err.Error())
+		}
+	}
+}
+
+// handleEncoders returns the encoders fitted during the run_id run, or during the latest run
+func (c *HTTPController) handleEncoders(w http.ResponseWriter, r *http.Request, p *PipelineEndpoints) {
+	encoders, err := p.DataProcessorService.GetEncoders(r.URL.Query().Get("run_id"))
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, service.ErrInvalidRunID) {
+			status = http.StatusBadRequest
+		}
+		c.writeError(w, status, err.Error())
+		return
+	}
+	c.writeJSON(w, http.StatusOK, encoders)
+}
+
+// handleRun returns the stage progress of a pipeline run
+func (c *HTTPController) handleRun(w http.ResponseWriter, r *http.Request, p *PipelineEndpoints) {
+	run, err := p.DataProcessorService.GetRunState(r.PathValue("run_id"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrRunNotFound) {
+			status = http.StatusNotFound
+		}
+		c.writeError(w, status, err.Error())
+		return
+	}
+	c.writeJSON(w, http.StatusOK, run)
+}
+
+// handleScalers returns the scalers fitted during the run_id run, or during the latest run
+func (c *HTTPController) handleScalers(w http.ResponseWriter, r *http.Request, p *PipelineEndpoints) {
+	scalers, err := p.DataProcessorService.GetScalers(r.URL.Query().Get("run_id"))
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, service.ErrInvalidRunID) {
+			status = http.StatusBadRequest
+		}
+		c.writeError(w, status, err.Error())
+		return
+	}
+	c.writeJSON(w, http.StatusOK, scalers)
+}
+
+// handleSchedulerStatus reports the next planned run and the result of the last run
+func (c *HTTPController) handleSchedulerStatus(w http.ResponseWriter, r *http.Request, p *PipelineEndpoints) {
+	c.writeJSON(w, http.StatusOK, p.RabbitMQController.Status())
+}
+
+// trackingWriter records whether any part of the response body has been written
+type trackingWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+// Write writes to the underlying response
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	t.written = true
+	return t.ResponseWriter.Write(p)
+}
+
+// writeJSON writes a JSON response
+func (c *HTTPController) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		c.logger.Warnf("Failed to write HTTP response: %v", err)
+	}
+}
+
+// writeError writes a JSON error response
+func (c *HTTPController) writeError(w http.ResponseWriter, status int, message string) {
+	c.writeJSON(w, status, map[string]string{"error": message})
+}
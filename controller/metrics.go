@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// metricFamily is a metric written in the Prometheus text format, with one sample per pipeline
+type metricFamily struct {
+	name    string
+	kind    string
+	help    string
+	samples []metricSample
+}
+
+// metricSample is a value of a metric labelled with its pipeline and an optional extra label
+type metricSample struct {
+	pipeline string
+	label    string
+	value    float64
+}
+
+// handleMetrics reports the run counters and the state of every pipeline in the Prometheus text format
+func (c *HTTPController) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	runs := metricFamily{name: "data_processor_runs_total", kind: "counter", help: "Finished pipeline runs by result."}
+	skipped := metricFamily{name: "data_processor_runs_skipped_total", kind: "counter", help: "Planned or triggered runs that were not started, by reason."}
+	duration := metricFamily{name: "data_processor_run_duration_seconds_total", kind: "counter", help: "Total duration of the pipeline runs."}
+	running := metricFamily{name: "data_processor_run_in_progress", kind: "gauge", help: "Whether a run of the pipeline is in progress."}
+	leader := metricFamily{name: "data_processor_leader", kind: "gauge", help: "Whether this instance is the leader of the pipeline."}
+	lastFinished := metricFamily{name: "data_processor_last_run_finished_timestamp_seconds", kind: "gauge", help: "Unix time the last run of the pipeline finished."}
+	queueDepth := metricFamily{name: "data_processor_queue_depth", kind: "gauge", help: "Messages waiting in the source queue when it was last checked."}
+	series := metricFamily{name: "data_processor_feature_series", kind: "gauge", help: "Product series in the feature cache."}
+
+	for _, p := range c.pipelines {
+		m := p.RabbitMQController.Metrics()
+		status := p.RabbitMQController.Status()
+
+		runs.add(p.Name, `result="succeeded"`, float64(m.Succeeded))
+		runs.add(p.Name, `result="failed"`, float64(m.Failed))
+		skipped.add(p.Name, `reason="standby"`, float64(m.SkippedStandby))
+		skipped.add(p.Name, `reason="blackout"`, float64(m.SkippedBlackout))
+		duration.add(p.Name, "", m.RunSeconds)
+		running.add(p.Name, "", boolValue(status.Running))
+		leader.add(p.Name, "", boolValue(status.Leader))
+		if status.LastRunFinished != nil {
+			lastFinished.add(p.Name, "", float64(status.LastRunFinished.Unix()))
+		}
+		if status.QueueDepth != nil {
+			queueDepth.add(p.Name, "", float64(*status.QueueDepth))
+		}
+		series.add(p.Name, "", float64(p.FeatureServingService.Status().Series))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, family := range []metricFamily{runs, skipped, duration, running, leader, lastFinished, queueDepth, series} {
+		family.write(w)
+	}
+}
+
+// add appends a sample of the pipeline
+func (f *metricFamily) add(pipeline string, label string, value float64) {
+	f.samples = append(f.samples, metricSample{pipeline: pipeline, label: label, value: value})
+}
+
+// write writes the metric with its HELP and TYPE lines, a metric without samples is left out
+func (f *metricFamily) write(w io.Writer) {
+	if len(f.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for _, sample := range f.samples {
+		labels := []string{fmt.Sprintf("pipeline=%q", sample.pipeline)}
+		if sample.label != "" {
+			labels = append(labels, sample.label)
+		}
+		fmt.Fprintf(w, "%s{%s} %g\n", f.name, strings.Join(labels, ","), sample.value)
+	}
+}
+
+// boolValue returns 1 for true and 0 for false
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -2,51 +2,314 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/graduate-work-mirea/data-processor-service/config"
+	"github.com/graduate-work-mirea/data-processor-service/internal/leader"
+	"github.com/graduate-work-mirea/data-processor-service/internal/schedule"
 	"github.com/graduate-work-mirea/data-processor-service/service"
 	"go.uber.org/zap"
 )
 
+// SchedulerStatus reports the planned and the last run of the scheduler
+type SchedulerStatus struct {
+	Schedule        string     `json:"schedule"`
+	Leader          bool       `json:"leader"`
+	NextRun         *time.Time `json:"next_run,omitempty"`
+	Running         bool       `json:"running"`
+	QueueDepth      *int       `json:"queue_depth,omitempty"`
+	QueueCheckedAt  *time.Time `json:"queue_checked_at,omitempty"`
+	LastTrigger     string     `json:"last_trigger,omitempty"`
+	LastRunStarted  *time.Time `json:"last_run_started,omitempty"`
+	LastRunFinished *time.Time `json:"last_run_finished,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+}
+
 // RabbitMQController handles incoming data from RabbitMQ
 type RabbitMQController struct {
 	dataProcessorService *service.DataProcessorService
+	schedule             *schedule.Schedule
+	elector              *leader.Elector
+	queueTrigger         config.QueueTriggerConfig
+	runOnStart           bool
 	logger               *zap.SugaredLogger
+
+	// backlogSince is when the oldest message of the current backlog was published or first seen
+	backlogSince time.Time
+
+	// Runs use their own context, so stopping the schedule does not interrupt a run
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	status  SchedulerStatus
+	metrics RunMetrics
+}
+
+// RunMetrics counts the runs of the scheduler since the service started
+type RunMetrics struct {
+	Succeeded int
+	Failed    int
+	// SkippedStandby and SkippedBlackout count planned or triggered runs that were not started
+	SkippedStandby  int
+	SkippedBlackout int
+	// RunSeconds is the total duration of the started runs
+	RunSeconds float64
 }
 
 // NewRabbitMQController creates a new RabbitMQController instance
-func NewRabbitMQController(dataProcessorService *service.DataProcessorService, logger *zap.SugaredLogger) *RabbitMQController {
+func NewRabbitMQController(
+	dataProcessorService *service.DataProcessorService,
+	schedule *schedule.Schedule,
+	elector *leader.Elector,
+	queueTrigger config.QueueTriggerConfig,
+	runOnStart bool,
+	logger *zap.SugaredLogger,
+) *RabbitMQController {
+	runCtx, cancelRun := context.WithCancel(context.Background())
 	return &RabbitMQController{
 		dataProcessorService: dataProcessorService,
+		schedule:             schedule,
+		elector:              elector,
+		queueTrigger:         queueTrigger,
+		runOnStart:           runOnStart,
 		logger:               logger,
+		status:               SchedulerStatus{Schedule: schedule.String()},
+		runCtx:               runCtx,
+		cancelRun:            cancelRun,
 	}
 }
 
-// StartProcessing starts processing data from RabbitMQ
-func (c *RabbitMQController) StartProcessing(ctx context.Context, interval time.Duration) {
-	c.logger.Info("Starting RabbitMQ controller")
+// StartProcessing starts processing data from RabbitMQ on the configured schedule.
+// No new runs are started once ctx is cancelled; use Shutdown to wait for the current run.
+func (c *RabbitMQController) StartProcessing(ctx context.Context) {
+	c.logger.Infof("Starting RabbitMQ controller with schedule %s", c.schedule)
+	if c.queueTrigger.Enabled() {
+		c.logger.Infof("Checking queue depth every %s (threshold %d, max age %s)",
+			c.queueTrigger.PollInterval, c.queueTrigger.Threshold, c.queueTrigger.MaxAge)
+	}
 
-	// Start a goroutine to periodically process data
+	// Start a goroutine that waits for the planned runs
+	c.wg.Add(1)
 	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+		defer c.wg.Done()
 
-		// Process data immediately on start
-		if err := c.dataProcessorService.ProcessMarketplaceData(ctx); err != nil {
-			c.logger.Errorf("Failed to process marketplace data: %v", err)
+		if c.runOnStart {
+			c.runUnlessBlackout("startup")
 		}
 
 		for {
-			select {
-			case <-ctx.Done():
+			next := c.schedule.Next(time.Now())
+			c.mu.Lock()
+			c.status.NextRun = &next
+			c.mu.Unlock()
+			c.logger.Infof("Next run planned at %s", next.Format(time.RFC3339))
+
+			trigger := c.waitForRun(ctx, next)
+			if trigger == "" {
 				c.logger.Info("RabbitMQ controller stopped")
 				return
-			case <-ticker.C:
-				c.logger.Info("Processing marketplace data (scheduled)")
-				if err := c.dataProcessorService.ProcessMarketplaceData(ctx); err != nil {
-					c.logger.Errorf("Failed to process marketplace data: %v", err)
-				}
 			}
+			c.runUnlessBlackout(trigger)
+
+			// The run changed the head of the queue
+			c.backlogSince = time.Time{}
 		}
 	}()
 }
+
+// waitForRun waits for the planned run or for a backlog in the queue and returns the trigger.
+// It returns an empty trigger once ctx is cancelled.
+func (c *RabbitMQController) waitForRun(ctx context.Context, next time.Time) string {
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	var poll <-chan time.Time
+	if c.queueTrigger.Enabled() {
+		ticker := time.NewTicker(c.queueTrigger.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-timer.C:
+			if ctx.Err() != nil {
+				return ""
+			}
+			return "scheduled"
+		case <-poll:
+			if trigger := c.checkQueue(); trigger != "" && ctx.Err() == nil {
+				return trigger
+			}
+		}
+	}
+}
+
+// checkQueue inspects the queue and returns a trigger when the depth reached the threshold
+// or the oldest message is older than the maximum age
+func (c *RabbitMQController) checkQueue() string {
+	// Standbys and blackout windows do not start runs, so the queue is not inspected either
+	if !c.isLeader() {
+		return ""
+	}
+	if _, ok := c.schedule.Blackout(time.Now()); ok {
+		return ""
+	}
+
+	depth, err := c.dataProcessorService.QueueDepth()
+	if err != nil {
+		c.logger.Warnf("Failed to check queue depth: %v", err)
+		return ""
+	}
+
+	checked := time.Now()
+	c.mu.Lock()
+	c.status.QueueDepth = &depth
+	c.status.QueueCheckedAt = &checked
+	c.mu.Unlock()
+
+	if depth == 0 {
+		c.backlogSince = time.Time{}
+		return ""
+	}
+	if c.queueTrigger.Threshold > 0 && depth >= c.queueTrigger.Threshold {
+		return fmt.Sprintf("queue depth %d", depth)
+	}
+
+	if c.queueTrigger.MaxAge > 0 {
+		if c.backlogSince.IsZero() {
+			// Without a publish timestamp the backlog is aged from the moment it was first seen
+			oldest, err := c.dataProcessorService.OldestMessageTime()
+			if err != nil {
+				c.logger.Warnf("Failed to check oldest message: %v", err)
+			}
+			if oldest.IsZero() || oldest.After(checked) {
+				oldest = checked
+			}
+			c.backlogSince = oldest
+		}
+		if age := checked.Sub(c.backlogSince); age >= c.queueTrigger.MaxAge {
+			return fmt.Sprintf("oldest message %s old", age.Round(time.Second))
+		}
+	}
+
+	return ""
+}
+
+// Shutdown waits for the current run after the schedule has been stopped. When the run does not
+// finish within the grace period it is cancelled and the processor's process group is killed.
+// Messages are requeued before Shutdown returns only if the run is cancelled while consuming;
+// a run past the consume stage has its batch on disk and is resumed from its saved state on the
+// next start.
+func (c *RabbitMQController) Shutdown(grace time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	c.mu.Lock()
+	running := c.status.Running
+	c.mu.Unlock()
+	if running {
+		c.logger.Infof("Waiting up to %s for the current run to finish", grace)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		c.logger.Warnf("Run did not finish within %s, cancelling it", grace)
+		c.cancelRun()
+		<-done
+	}
+	c.cancelRun()
+	c.logger.Info("RabbitMQ controller shut down")
+}
+
+// Status returns the current scheduler status
+func (c *RabbitMQController) Status() SchedulerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.status
+	status.Leader = c.isLeader()
+	return status
+}
+
+// Metrics returns the run counters of the scheduler
+func (c *RabbitMQController) Metrics() RunMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.metrics
+}
+
+// isLeader reports whether this instance runs the pipeline; without election every instance does
+func (c *RabbitMQController) isLeader() bool {
+	return c.elector == nil || c.elector.IsLeader()
+}
+
+// leaderContext returns the context of a run, cancelled when this instance stops being the leader
+// so that a standby taking over does not run the pipeline at the same time
+func (c *RabbitMQController) leaderContext() (context.Context, context.CancelFunc) {
+	if c.elector == nil {
+		return context.WithCancel(c.runCtx)
+	}
+	return c.elector.Context(c.runCtx)
+}
+
+// runUnlessBlackout processes marketplace data unless the current time is in a blackout window
+// or another replica is the leader
+func (c *RabbitMQController) runUnlessBlackout(trigger string) {
+	if !c.isLeader() {
+		c.logger.Infof("Skipping %s run, this instance is a standby replica", trigger)
+		c.mu.Lock()
+		c.metrics.SkippedStandby++
+		c.mu.Unlock()
+		return
+	}
+	if window, ok := c.schedule.Blackout(time.Now()); ok {
+		c.logger.Infof("Skipping %s run during blackout window %s", trigger, window)
+		c.mu.Lock()
+		c.metrics.SkippedBlackout++
+		c.mu.Unlock()
+		return
+	}
+
+	c.logger.Infof("Processing marketplace data (%s)", trigger)
+	started := time.Now()
+	c.mu.Lock()
+	c.status.Running = true
+	c.status.NextRun = nil
+	c.status.LastTrigger = trigger
+	c.status.LastRunStarted = &started
+	c.mu.Unlock()
+
+	runCtx, cancel := c.leaderContext()
+	err := c.dataProcessorService.ProcessMarketplaceData(runCtx)
+	if runCtx.Err() != nil && c.runCtx.Err() == nil {
+		c.logger.Warnf("Aborted %s run, leadership was lost", trigger)
+	}
+	cancel()
+	if err != nil {
+		c.logger.Errorf("Failed to process marketplace data: %v", err)
+	}
+
+	finished := time.Now()
+	c.mu.Lock()
+	c.status.Running = false
+	c.status.LastRunFinished = &finished
+	c.status.LastError = ""
+	c.metrics.RunSeconds += finished.Sub(started).Seconds()
+	if err != nil {
+		c.status.LastError = err.Error()
+		c.metrics.Failed++
+	} else {
+		c.metrics.Succeeded++
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,516 @@
+package featurespec
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the declarative description of the features and targets built by the processor
+type Spec struct {
+	Version     int          `yaml:"version" json:"version"`
+	SeriesKey   []string     `yaml:"series_key" json:"series_key"`
+	CrossRegion *CrossRegion `yaml:"cross_region,omitempty" json:"cross_region,omitempty"`
+	MinHistory  int          `yaml:"min_history" json:"min_history"`
+	Features    []Feature    `yaml:"features" json:"features"`
+	Hierarchy   *Hierarchy   `yaml:"hierarchy,omitempty" json:"hierarchy,omitempty"`
+	Targets     []Target     `yaml:"targets" json:"targets"`
+	Encoding    *Encoding    `yaml:"encoding,omitempty" json:"encoding,omitempty"`
+	Scaling     *Scaling     `yaml:"scaling,omitempty" json:"scaling,omitempty"`
+}
+
+// Scaling describes numeric column scaling fitted on the training split
+type Scaling struct {
+	Columns []ScaledColumn `yaml:"columns" json:"columns"`
+}
+
+// ScaledColumn describes the scaling of one numeric column into <column>_scaled;
+// the raw column is kept
+type ScaledColumn struct {
+	Column string `yaml:"column" json:"column"`
+	Method string `yaml:"method" json:"method"`
+}
+
+// Encoding describes categorical encodings fitted on the training split
+type Encoding struct {
+	Columns []EncodedColumn `yaml:"columns" json:"columns"`
+}
+
+// EncodedColumn describes the encoding of one categorical column:
+// label produces <column>_label, onehot <column>_onehot_<index> and
+// target the out-of-fold <column>_target_enc
+type EncodedColumn struct {
+	Column    string  `yaml:"column" json:"column"`
+	Method    string  `yaml:"method" json:"method"`
+	Target    string  `yaml:"target,omitempty" json:"target,omitempty"`
+	Folds     int     `yaml:"folds,omitempty" json:"folds,omitempty"`
+	Smoothing float64 `yaml:"smoothing,omitempty" json:"smoothing,omitempty"`
+}
+
+// Hierarchy describes per-date aggregates over groups of products joined back onto product rows
+type Hierarchy struct {
+	Levels []HierarchyLevel `yaml:"levels" json:"levels"`
+	// Aggregations computed for every level: sales_total, price_mean, price_median
+	Aggregations []string `yaml:"aggregations" json:"aggregations"`
+	// ShareOf names the level used for the product's share of sales
+	ShareOf string `yaml:"share_of,omitempty" json:"share_of,omitempty"`
+	// PriceRelativeTo names the level whose median price the product price is compared to
+	PriceRelativeTo string `yaml:"price_relative_to,omitempty" json:"price_relative_to,omitempty"`
+}
+
+// HierarchyLevel is a group of products defined by the key columns
+type HierarchyLevel struct {
+	Name string   `yaml:"name" json:"name"`
+	Keys []string `yaml:"keys" json:"keys"`
+}
+
+// CrossRegion enables aggregate series that combine all regions of a product
+type CrossRegion struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled"`
+	RegionLabel string `yaml:"region_label" json:"region_label"`
+}
+
+// Feature describes the features derived from one source column.
+// Every family except the source is optional.
+type Feature struct {
+	Source          string    `yaml:"source" json:"source"`
+	Lags            []int     `yaml:"lags" json:"lags"`
+	Rolling         *Rolling  `yaml:"rolling,omitempty" json:"rolling,omitempty"`
+	EWM             *EWM      `yaml:"ewm,omitempty" json:"ewm,omitempty"`
+	PctChange       *Periods  `yaml:"pct_change,omitempty" json:"pct_change,omitempty"`
+	Diff            *Periods  `yaml:"diff,omitempty" json:"diff,omitempty"`
+	DaysSinceChange bool      `yaml:"days_since_change" json:"days_since_change"`
+	Velocity        *Velocity `yaml:"velocity,omitempty" json:"velocity,omitempty"`
+}
+
+// Rolling describes rolling window aggregations of a source column
+type Rolling struct {
+	Windows      []int    `yaml:"windows" json:"windows"`
+	Aggregations []string `yaml:"aggregations" json:"aggregations"`
+}
+
+// EWM describes exponentially weighted means of a source column
+type EWM struct {
+	Spans []int `yaml:"spans" json:"spans"`
+}
+
+// Periods describes changes of a source column over a number of observations
+type Periods struct {
+	Periods []int `yaml:"periods" json:"periods"`
+}
+
+// Velocity describes the change of a source column per day over a window of observations
+type Velocity struct {
+	Windows []int `yaml:"windows" json:"windows"`
+}
+
+// Target describes a prediction target computed from future values of a source column.
+// One column named <name>_h<horizon> is produced for every horizon.
+type Target struct {
+	Name        string   `yaml:"name" json:"name"`
+	Source      string   `yaml:"source" json:"source"`
+	Horizons    []int    `yaml:"horizons" json:"horizons"`
+	Aggregation string   `yaml:"aggregation" json:"aggregation"`
+	FillValue   *float64 `yaml:"fill_value,omitempty" json:"fill_value,omitempty"`
+}
+
+// Default series key: lags, rolling statistics and targets are computed per product and region
+var defaultSeriesKey = []string{"product_id", "region"}
+
+// defaultCrossRegionLabel is the region value of cross-region aggregate series
+const defaultCrossRegionLabel = "__all__"
+
+// seriesKeyColumns are the columns a series can be partitioned by
+var seriesKeyColumns = map[string]bool{"product_id": true, "region": true, "brand": true, "category": true, "seller": true}
+
+// Defaults of target encoding
+const (
+	defaultEncodingFolds     = 5
+	defaultEncodingSmoothing = 10
+)
+
+// categoricalColumns are the columns that can be encoded
+var categoricalColumns = map[string]bool{"brand": true, "category": true, "region": true, "seller": true}
+
+// encodingMethods are the supported categorical encodings
+var encodingMethods = map[string]bool{"label": true, "onehot": true, "target": true}
+
+// scalingMethods are the supported scalers
+var scalingMethods = map[string]bool{"standard": true, "minmax": true, "robust": true}
+
+// hierarchyKeyColumns are the columns hierarchy levels can group by
+var hierarchyKeyColumns = map[string]bool{"category": true, "brand": true, "region": true, "seller": true}
+
+// Supported aggregations
+var (
+	hierarchyAggregations = map[string]bool{"sales_total": true, "price_mean": true, "price_median": true}
+	rollingAggregations   = map[string]bool{"mean": true, "sum": true, "std": true, "min": true, "max": true, "median": true}
+	targetAggregations    = map[string]bool{"point": true, "sum": true, "mean": true, "max": true}
+)
+
+// identifierPattern restricts names to safe SQL column identifiers
+var identifierPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Load reads and validates a feature specification from a YAML file
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feature spec: %w", err)
+	}
+
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse feature spec: %w", err)
+	}
+	spec.applyDefaults()
+
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid feature spec %s: %w", path, err)
+	}
+
+	return &spec, nil
+}
+
+// applyDefaults fills optional settings that are not set in the file
+func (s *Spec) applyDefaults() {
+	if len(s.SeriesKey) == 0 {
+		s.SeriesKey = append([]string(nil), defaultSeriesKey...)
+	}
+	if s.CrossRegion != nil && s.CrossRegion.RegionLabel == "" {
+		s.CrossRegion.RegionLabel = defaultCrossRegionLabel
+	}
+	if s.Encoding != nil {
+		for i := range s.Encoding.Columns {
+			col := &s.Encoding.Columns[i]
+			if col.Method == "target" && col.Folds == 0 {
+				col.Folds = defaultEncodingFolds
+			}
+			if col.Method == "target" && col.Smoothing == 0 {
+				col.Smoothing = defaultEncodingSmoothing
+			}
+		}
+	}
+}
+
+// Validate checks the specification for unsupported values and duplicate columns
+func (s *Spec) Validate() error {
+	if s.Version <= 0 {
+		return fmt.Errorf("version must be positive")
+	}
+
+	hasProduct, hasRegion := false, false
+	for _, col := range s.SeriesKey {
+		if !seriesKeyColumns[col] {
+			return fmt.Errorf("unsupported series key column %q", col)
+		}
+		hasProduct = hasProduct || col == "product_id"
+		hasRegion = hasRegion || col == "region"
+	}
+	if !hasProduct {
+		return fmt.Errorf("series key must include product_id")
+	}
+	if s.CrossRegion != nil && s.CrossRegion.Enabled && !hasRegion {
+		return fmt.Errorf("cross-region series require region in the series key")
+	}
+	if s.MinHistory < 1 {
+		return fmt.Errorf("min_history must be at least 1")
+	}
+
+	for _, f := range s.Features {
+		if !identifierPattern.MatchString(f.Source) {
+			return fmt.Errorf("invalid feature source %q", f.Source)
+		}
+		for _, lag := range f.Lags {
+			if lag < 1 {
+				return fmt.Errorf("feature %s: lags must be positive", f.Source)
+			}
+		}
+		if f.Rolling != nil {
+			for _, window := range f.Rolling.Windows {
+				if window < 1 {
+					return fmt.Errorf("feature %s: rolling windows must be positive", f.Source)
+				}
+			}
+			for _, agg := range f.Rolling.Aggregations {
+				if !rollingAggregations[agg] {
+					return fmt.Errorf("feature %s: unsupported rolling aggregation %q", f.Source, agg)
+				}
+			}
+		}
+		if f.EWM != nil && !allPositive(f.EWM.Spans) {
+			return fmt.Errorf("feature %s: ewm spans must be positive", f.Source)
+		}
+		if f.PctChange != nil && !allPositive(f.PctChange.Periods) {
+			return fmt.Errorf("feature %s: pct_change periods must be positive", f.Source)
+		}
+		if f.Diff != nil && !allPositive(f.Diff.Periods) {
+			return fmt.Errorf("feature %s: diff periods must be positive", f.Source)
+		}
+		if f.Velocity != nil && !allPositive(f.Velocity.Windows) {
+			return fmt.Errorf("feature %s: velocity windows must be positive", f.Source)
+		}
+	}
+
+	if err := s.validateHierarchy(); err != nil {
+		return err
+	}
+
+	for _, t := range s.Targets {
+		if !identifierPattern.MatchString(t.Name) || !identifierPattern.MatchString(t.Source) {
+			return fmt.Errorf("invalid target %q with source %q", t.Name, t.Source)
+		}
+		if len(t.Horizons) == 0 || !allPositive(t.Horizons) {
+			return fmt.Errorf("target %s: horizons must be a non-empty list of positive values", t.Name)
+		}
+		if !targetAggregations[t.Aggregation] {
+			return fmt.Errorf("target %s: unsupported aggregation %q", t.Name, t.Aggregation)
+		}
+	}
+
+	if err := s.validateEncoding(); err != nil {
+		return err
+	}
+	if err := s.validateScaling(); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, col := range s.Columns() {
+		if seen[col] {
+			return fmt.Errorf("duplicate column %s", col)
+		}
+		seen[col] = true
+	}
+
+	return nil
+}
+
+// validateHierarchy checks hierarchy levels, aggregations and level references
+func (s *Spec) validateHierarchy() error {
+	h := s.Hierarchy
+	if h == nil {
+		return nil
+	}
+
+	levels := make(map[string]bool)
+	for _, level := range h.Levels {
+		if !identifierPattern.MatchString(level.Name) {
+			return fmt.Errorf("invalid hierarchy level name %q", level.Name)
+		}
+		if len(level.Keys) == 0 {
+			return fmt.Errorf("hierarchy level %s: keys must not be empty", level.Name)
+		}
+		for _, key := range level.Keys {
+			if !hierarchyKeyColumns[key] {
+				return fmt.Errorf("hierarchy level %s: unsupported key column %q", level.Name, key)
+			}
+		}
+		levels[level.Name] = true
+	}
+
+	for _, agg := range h.Aggregations {
+		if !hierarchyAggregations[agg] {
+			return fmt.Errorf("unsupported hierarchy aggregation %q", agg)
+		}
+	}
+	if h.ShareOf != "" && !levels[h.ShareOf] {
+		return fmt.Errorf("share_of refers to unknown hierarchy level %q", h.ShareOf)
+	}
+	if h.PriceRelativeTo != "" && !levels[h.PriceRelativeTo] {
+		return fmt.Errorf("price_relative_to refers to unknown hierarchy level %q", h.PriceRelativeTo)
+	}
+
+	return nil
+}
+
+// validateEncoding checks encoded columns, methods and target references
+func (s *Spec) validateEncoding() error {
+	if s.Encoding == nil {
+		return nil
+	}
+
+	targets := make(map[string]bool)
+	for _, col := range s.TargetColumns() {
+		targets[col] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, col := range s.Encoding.Columns {
+		if !categoricalColumns[col.Column] {
+			return fmt.Errorf("unsupported encoded column %q", col.Column)
+		}
+		if !encodingMethods[col.Method] {
+			return fmt.Errorf("column %s: unsupported encoding method %q", col.Column, col.Method)
+		}
+		if seen[col.Column] {
+			return fmt.Errorf("column %s is encoded more than once", col.Column)
+		}
+		seen[col.Column] = true
+
+		if col.Method == "target" {
+			if !targets[col.Target] {
+				return fmt.Errorf("column %s: target encoding refers to unknown target %q", col.Column, col.Target)
+			}
+			if col.Folds < 2 {
+				return fmt.Errorf("column %s: target encoding needs at least 2 folds", col.Column)
+			}
+			if col.Smoothing < 0 {
+				return fmt.Errorf("column %s: smoothing must not be negative", col.Column)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateScaling checks scaled columns and methods; targets and categorical columns cannot be scaled
+func (s *Spec) validateScaling() error {
+	if s.Scaling == nil {
+		return nil
+	}
+
+	targets := make(map[string]bool)
+	for _, col := range s.TargetColumns() {
+		targets[col] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, col := range s.Scaling.Columns {
+		if !identifierPattern.MatchString(col.Column) || categoricalColumns[col.Column] || targets[col.Column] {
+			return fmt.Errorf("column %q cannot be scaled", col.Column)
+		}
+		if !scalingMethods[col.Method] {
+			return fmt.Errorf("column %s: unsupported scaling method %q", col.Column, col.Method)
+		}
+		if seen[col.Column] {
+			return fmt.Errorf("column %s is scaled more than once", col.Column)
+		}
+		seen[col.Column] = true
+	}
+
+	return nil
+}
+
+// ScaledColumns returns the names of the scaled copies of numeric columns
+func (s *Spec) ScaledColumns() []string {
+	if s.Scaling == nil {
+		return nil
+	}
+
+	columns := make([]string, 0, len(s.Scaling.Columns))
+	for _, col := range s.Scaling.Columns {
+		columns = append(columns, col.Column+"_scaled")
+	}
+	return columns
+}
+
+// IsEncodedColumn reports whether an output column is produced by a categorical encoder.
+// One-hot columns depend on the fitted vocabulary, so they are matched by prefix.
+func (s *Spec) IsEncodedColumn(name string) bool {
+	if s.Encoding == nil {
+		return false
+	}
+
+	for _, col := range s.Encoding.Columns {
+		switch col.Method {
+		case "label":
+			if name == col.Column+"_label" {
+				return true
+			}
+		case "onehot":
+			if strings.HasPrefix(name, col.Column+"_onehot_") {
+				return true
+			}
+		case "target":
+			if name == col.Column+"_target_enc" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// FeatureColumns returns the names of the generated feature columns, followed by the scaled columns
+func (s *Spec) FeatureColumns() []string {
+	var columns []string
+	for _, f := range s.Features {
+		for _, lag := range f.Lags {
+			columns = append(columns, fmt.Sprintf("%s_lag_%d", f.Source, lag))
+		}
+		if f.Rolling != nil {
+			for _, window := range f.Rolling.Windows {
+				for _, agg := range f.Rolling.Aggregations {
+					columns = append(columns, fmt.Sprintf("%s_rolling_%s_%d", f.Source, agg, window))
+				}
+			}
+		}
+		if f.EWM != nil {
+			for _, span := range f.EWM.Spans {
+				columns = append(columns, fmt.Sprintf("%s_ewm_%d", f.Source, span))
+			}
+		}
+		if f.PctChange != nil {
+			for _, period := range f.PctChange.Periods {
+				columns = append(columns, fmt.Sprintf("%s_pct_change_%d", f.Source, period))
+			}
+		}
+		if f.Diff != nil {
+			for _, period := range f.Diff.Periods {
+				columns = append(columns, fmt.Sprintf("%s_diff_%d", f.Source, period))
+			}
+		}
+		if f.DaysSinceChange {
+			columns = append(columns, fmt.Sprintf("%s_days_since_change", f.Source))
+		}
+		if f.Velocity != nil {
+			for _, window := range f.Velocity.Windows {
+				columns = append(columns, fmt.Sprintf("%s_velocity_%d", f.Source, window))
+			}
+		}
+	}
+
+	if h := s.Hierarchy; h != nil {
+		for _, level := range h.Levels {
+			for _, agg := range h.Aggregations {
+				columns = append(columns, fmt.Sprintf("%s_%s", level.Name, agg))
+			}
+		}
+		if h.ShareOf != "" {
+			columns = append(columns, fmt.Sprintf("%s_sales_share", h.ShareOf))
+		}
+		if h.PriceRelativeTo != "" {
+			columns = append(columns, fmt.Sprintf("%s_price_ratio_median", h.PriceRelativeTo))
+		}
+	}
+	return append(columns, s.ScaledColumns()...)
+}
+
+// TargetColumns returns the names of the generated target columns
+func (s *Spec) TargetColumns() []string {
+	var columns []string
+	for _, t := range s.Targets {
+		for _, horizon := range t.Horizons {
+			columns = append(columns, fmt.Sprintf("%s_h%d", t.Name, horizon))
+		}
+	}
+	return columns
+}
+
+// Columns returns all generated columns: features followed by targets
+func (s *Spec) Columns() []string {
+	return append(s.FeatureColumns(), s.TargetColumns()...)
+}
+
+// allPositive reports whether every value is at least 1
+func allPositive(values []int) bool {
+	for _, v := range values {
+		if v < 1 {
+			return false
+		}
+	}
+	return true
+}
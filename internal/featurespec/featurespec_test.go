@@ -0,0 +1,218 @@
+package featurespec
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadYAML writes a spec document to a temporary file and loads it
+func loadYAML(t *testing.T, doc string) (*Spec, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "feature_spec.yaml")
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestLoadBundledSpec(t *testing.T) {
+	spec, err := Load(filepath.Join("..", "..", "specs", "feature_spec.yaml"))
+	if err != nil {
+		t.Fatalf("bundled spec does not load: %v", err)
+	}
+	if len(spec.FeatureColumns()) == 0 || len(spec.TargetColumns()) == 0 {
+		t.Fatalf("bundled spec generates %d features and %d targets", len(spec.FeatureColumns()), len(spec.TargetColumns()))
+	}
+}
+
+func TestColumns(t *testing.T) {
+	spec, err := loadYAML(t, `
+version: 1
+min_history: 7
+features:
+  - source: sales_quantity
+    lags: [1, 7]
+    rolling: {windows: [7], aggregations: [mean, max]}
+  - source: price
+    ewm: {spans: [3]}
+    pct_change: {periods: [1]}
+    diff: {periods: [7]}
+    days_since_change: true
+    velocity: {windows: [7]}
+targets:
+  - name: sales_target
+    source: sales_quantity
+    horizons: [1, 7]
+    aggregation: sum
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFeatures := []string{
+		"sales_quantity_lag_1",
+		"sales_quantity_lag_7",
+		"sales_quantity_rolling_mean_7",
+		"sales_quantity_rolling_max_7",
+		"price_ewm_3",
+		"price_pct_change_1",
+		"price_diff_7",
+		"price_days_since_change",
+		"price_velocity_7",
+	}
+	if got := spec.FeatureColumns(); !reflect.DeepEqual(got, wantFeatures) {
+		t.Errorf("FeatureColumns() = %v, want %v", got, wantFeatures)
+	}
+	wantTargets := []string{"sales_target_h1", "sales_target_h7"}
+	if got := spec.TargetColumns(); !reflect.DeepEqual(got, wantTargets) {
+		t.Errorf("TargetColumns() = %v, want %v", got, wantTargets)
+	}
+	if got := spec.Columns(); len(got) != len(wantFeatures)+len(wantTargets) || got[len(got)-1] != "sales_target_h7" {
+		t.Errorf("Columns() = %v, want features followed by targets", got)
+	}
+}
+
+func TestLoadRejectsInvalidSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{
+			name:    "missing version",
+			doc:     "min_history: 1\n",
+			wantErr: "version must be positive",
+		},
+		{
+			name:    "no history",
+			doc:     "version: 1\nmin_history: 0\n",
+			wantErr: "min_history must be at least 1",
+		},
+		{
+			name:    "source is not an identifier",
+			doc:     "version: 1\nmin_history: 1\nfeatures:\n  - source: Sales Quantity\n",
+			wantErr: `invalid feature source "Sales Quantity"`,
+		},
+		{
+			name:    "zero lag",
+			doc:     "version: 1\nmin_history: 1\nfeatures:\n  - source: price\n    lags: [0]\n",
+			wantErr: "feature price: lags must be positive",
+		},
+		{
+			name:    "unknown rolling aggregation",
+			doc:     "version: 1\nmin_history: 1\nfeatures:\n  - source: price\n    rolling: {windows: [7], aggregations: [mode]}\n",
+			wantErr: `unsupported rolling aggregation "mode"`,
+		},
+		{
+			name:    "negative velocity window",
+			doc:     "version: 1\nmin_history: 1\nfeatures:\n  - source: review_count\n    velocity: {windows: [-7]}\n",
+			wantErr: "velocity windows must be positive",
+		},
+		{
+			name:    "target without horizons",
+			doc:     "version: 1\nmin_history: 1\ntargets:\n  - {name: sales, source: sales_quantity, aggregation: sum}\n",
+			wantErr: "target sales: horizons must be a non-empty list",
+		},
+		{
+			name:    "unknown target aggregation",
+			doc:     "version: 1\nmin_history: 1\ntargets:\n  - {name: sales, source: sales_quantity, horizons: [1], aggregation: median}\n",
+			wantErr: `unsupported aggregation "median"`,
+		},
+		{
+			name:    "source declared twice",
+			doc:     "version: 1\nmin_history: 1\nfeatures:\n  - {source: price, lags: [1]}\n  - {source: price, lags: [1, 7]}\n",
+			wantErr: "duplicate column price_lag_1",
+		},
+		{
+			name:    "not YAML",
+			doc:     "version: [1\n",
+			wantErr: "failed to parse feature spec",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadYAML(t, tt.doc)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Load() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       string
+		wantKey   []string
+		wantLabel string
+		wantErr   string
+	}{
+		{
+			name:    "defaults to product and region",
+			doc:     "version: 1\nmin_history: 1\n",
+			wantKey: []string{"product_id", "region"},
+		},
+		{
+			name:    "product only",
+			doc:     "version: 1\nmin_history: 1\nseries_key: [product_id]\n",
+			wantKey: []string{"product_id"},
+		},
+		{
+			name:    "seller series",
+			doc:     "version: 1\nmin_history: 1\nseries_key: [product_id, region, seller]\n",
+			wantKey: []string{"product_id", "region", "seller"},
+		},
+		{
+			name:      "cross-region label defaults",
+			doc:       "version: 1\nmin_history: 1\ncross_region: {enabled: true}\n",
+			wantKey:   []string{"product_id", "region"},
+			wantLabel: "__all__",
+		},
+		{
+			name:      "custom cross-region label",
+			doc:       "version: 1\nmin_history: 1\ncross_region: {enabled: true, region_label: total}\n",
+			wantKey:   []string{"product_id", "region"},
+			wantLabel: "total",
+		},
+		{
+			name:    "region without product",
+			doc:     "version: 1\nmin_history: 1\nseries_key: [region]\n",
+			wantErr: "series key must include product_id",
+		},
+		{
+			name:    "unsupported column",
+			doc:     "version: 1\nmin_history: 1\nseries_key: [product_id, date]\n",
+			wantErr: `unsupported series key column "date"`,
+		},
+		{
+			name:    "cross-region without region",
+			doc:     "version: 1\nmin_history: 1\nseries_key: [product_id]\ncross_region: {enabled: true}\n",
+			wantErr: "cross-region series require region in the series key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := loadYAML(t, tt.doc)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() returned %v", err)
+			}
+			if !reflect.DeepEqual(spec.SeriesKey, tt.wantKey) {
+				t.Errorf("series key = %v, want %v", spec.SeriesKey, tt.wantKey)
+			}
+			if tt.wantLabel != "" && spec.CrossRegion.RegionLabel != tt.wantLabel {
+				t.Errorf("cross-region label = %q, want %q", spec.CrossRegion.RegionLabel, tt.wantLabel)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Lock is a lock held by at most one instance at a time
+type Lock interface {
+	// TryAcquire takes the lock without waiting and reports whether it was taken
+	TryAcquire(ctx context.Context) (bool, error)
+	// Check returns an error when a taken lock has been lost
+	Check(ctx context.Context) error
+	// Release gives a taken lock up
+	Release()
+	// String describes the lock for logs
+	String() string
+}
+
+// Elector keeps trying to take a lock so that exactly one replica acts as the leader.
+// A standby replica takes over once the leader releases the lock or its session drops.
+type Elector struct {
+	lock     Lock
+	interval time.Duration
+	logger   *zap.SugaredLogger
+
+	mu     sync.RWMutex
+	leader bool
+	// lost is closed when the current leadership ends
+	lost chan struct{}
+	done chan struct{}
+}
+
+// NewElector creates a new Elector that checks the lock every interval
+func NewElector(lock Lock, interval time.Duration, logger *zap.SugaredLogger) *Elector {
+	return &Elector{
+		lock:     lock,
+		interval: interval,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+}
+
+// Run takes part in the election until the context is cancelled, then releases the lock.
+// The first attempt is made before Run returns, so a leader knows its role right away.
+func (e *Elector) Run(ctx context.Context) {
+	e.logger.Infof("Starting leader election on %s", e.lock)
+	e.step(ctx)
+	if !e.IsLeader() {
+		e.logger.Info("Another instance is the leader, waiting as standby")
+	}
+
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				if e.IsLeader() {
+					e.lock.Release()
+					e.setLeader(false)
+					e.logger.Info("Released leadership")
+				}
+				return
+			case <-ticker.C:
+				e.step(ctx)
+			}
+		}
+	}()
+}
+
+// Wait blocks until the election has stopped and the lock is released
+func (e *Elector) Wait() {
+	<-e.done
+}
+
+// IsLeader reports whether this instance currently holds the lock
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Context returns a context that is cancelled when the leadership held now is lost.
+// It is cancelled right away when this instance is not the leader.
+func (e *Elector) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	e.mu.RLock()
+	leader, lost := e.leader, e.lost
+	e.mu.RUnlock()
+	if !leader {
+		cancel()
+		return ctx, cancel
+	}
+
+	go func() {
+		select {
+		case <-lost:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// step acquires the lock as a standby or verifies it as the leader
+func (e *Elector) step(ctx context.Context) {
+	if e.IsLeader() {
+		if err := e.lock.Check(ctx); err != nil {
+			e.logger.Warnf("Lost leadership: %v", err)
+			e.lock.Release()
+			e.setLeader(false)
+		}
+		return
+	}
+
+	acquired, err := e.lock.TryAcquire(ctx)
+	if err != nil {
+		e.logger.Warnf("Failed to acquire leadership: %v", err)
+		return
+	}
+	if acquired {
+		e.logger.Info("Became leader, scheduled runs are enabled on this instance")
+		e.setLeader(true)
+	}
+}
+
+// setLeader records the leadership state and ends the contexts of a lost leadership
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if leader && !e.leader {
+		e.lost = make(chan struct{})
+	} else if !leader && e.leader {
+		close(e.lost)
+	}
+	e.leader = leader
+}
@@ -0,0 +1,260 @@
+package plugin
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestFile is the name of the manifest in a processor's directory
+const ManifestFile = "processor.yaml"
+
+// Exit codes of a processor, any other non-zero code is a failure that may be retried
+const (
+	// ExitOK means the processor wrote every split to the output directory
+	ExitOK = 0
+	// ExitInvalidInput means the processor cannot use its input, running it again will not help
+	ExitInvalidInput = 2
+	// ExitSkipped means the processor has nothing to change, its input is passed on unchanged
+	ExitSkipped = 3
+)
+
+// Column types of a schema
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeDate    = "date"
+)
+
+// columnTypes are the supported column types
+var columnTypes = map[string]bool{TypeString: true, TypeNumber: true, TypeInteger: true, TypeBoolean: true, TypeDate: true}
+
+// namePattern keeps processor names usable as directory names and in the run record
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Manifest describes an external processor chained after the built-in one
+type Manifest struct {
+	Name        string `yaml:"name"`
+	Version     int    `yaml:"version"`
+	Description string `yaml:"description"`
+	// Command is the executable and its arguments, run in the manifest's directory
+	Command []string `yaml:"command"`
+	// TimeoutSeconds bounds one run of the processor, 0 leaves the limits of the transform stage
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+	// Input lists the columns the processor reads, Output the columns its outputs must have
+	Input  Schema `yaml:"input"`
+	Output Schema `yaml:"output"`
+	// Dir is the absolute directory of the manifest
+	Dir string `yaml:"-"`
+}
+
+// Schema lists the columns expected in the split files
+type Schema struct {
+	Columns []Column `yaml:"columns"`
+}
+
+// Column is a column of a schema. Empty values are allowed only in nullable columns.
+type Column struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Nullable bool   `yaml:"nullable"`
+}
+
+// Load reads and validates a processor manifest
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processor manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse processor manifest %s: %w", path, err)
+	}
+	manifest.Dir, err = filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory of processor manifest %s: %w", path, err)
+	}
+
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid processor manifest %s: %w", path, err)
+	}
+
+	return &manifest, nil
+}
+
+// LoadChain loads the manifests of the named processors from <dir>/<name>/processor.yaml, in order
+func LoadChain(dir string, names []string) ([]*Manifest, error) {
+	chain := make([]*Manifest, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("processor %s is chained twice", name)
+		}
+		seen[name] = true
+
+		manifest, err := Load(filepath.Join(dir, name, ManifestFile))
+		if err != nil {
+			return nil, err
+		}
+		if manifest.Name != name {
+			return nil, fmt.Errorf("processor manifest in %s is named %s", manifest.Dir, manifest.Name)
+		}
+		chain = append(chain, manifest)
+	}
+	return chain, nil
+}
+
+// Validate checks the manifest for missing and unsupported values
+func (m *Manifest) Validate() error {
+	if !namePattern.MatchString(m.Name) {
+		return fmt.Errorf("name must match %s", namePattern)
+	}
+	if m.Version <= 0 {
+		return fmt.Errorf("version must be positive")
+	}
+	if len(m.Command) == 0 || m.Command[0] == "" {
+		return fmt.Errorf("command is required")
+	}
+	if m.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeout_seconds must not be negative")
+	}
+	if err := m.Input.validate(); err != nil {
+		return fmt.Errorf("input: %w", err)
+	}
+	if err := m.Output.validate(); err != nil {
+		return fmt.Errorf("output: %w", err)
+	}
+	return nil
+}
+
+// Executable returns the program of the command. A relative path such as ./run.sh is resolved
+// against the manifest's directory, a bare name such as python3 is looked up in PATH.
+func (m *Manifest) Executable() string {
+	program := m.Command[0]
+	if filepath.IsAbs(program) || !strings.ContainsRune(program, filepath.Separator) {
+		return program
+	}
+	return filepath.Join(m.Dir, program)
+}
+
+// Timeout returns the timeout of one run of the processor, 0 when none is declared
+func (m *Manifest) Timeout() time.Duration {
+	return time.Duration(m.TimeoutSeconds) * time.Second
+}
+
+// validate checks the schema for unsupported types and duplicate columns
+func (s Schema) validate() error {
+	seen := make(map[string]bool, len(s.Columns))
+	for _, col := range s.Columns {
+		if col.Name == "" {
+			return fmt.Errorf("column name is required")
+		}
+		if seen[col.Name] {
+			return fmt.Errorf("duplicate column %s", col.Name)
+		}
+		seen[col.Name] = true
+		if !columnTypes[col.Type] {
+			return fmt.Errorf("column %s has unsupported type %q", col.Name, col.Type)
+		}
+	}
+	return nil
+}
+
+// ValidateCSV checks that a CSV file has the schema's columns with values of their types
+// and returns its row count
+func (s Schema) ValidateCSV(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("%s is empty", filepath.Base(path))
+		}
+		return 0, fmt.Errorf("failed to read header of %s: %w", filepath.Base(path), err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[name] = i
+	}
+	positions := make([]int, len(s.Columns))
+	for i, col := range s.Columns {
+		pos, ok := index[col.Name]
+		if !ok {
+			return 0, fmt.Errorf("%s has no %s column", filepath.Base(path), col.Name)
+		}
+		positions[i] = pos
+	}
+
+	rows := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		rows++
+
+		for i, col := range s.Columns {
+			if err := col.check(record[positions[i]]); err != nil {
+				return 0, fmt.Errorf("%s row %d: column %s: %w", filepath.Base(path), rows, col.Name, err)
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// check validates a single value of the column
+func (c Column) check(value string) error {
+	if value == "" {
+		if c.Nullable {
+			return nil
+		}
+		return fmt.Errorf("empty value")
+	}
+
+	var err error
+	switch c.Type {
+	case TypeNumber:
+		_, err = strconv.ParseFloat(value, 64)
+	case TypeInteger:
+		// pandas writes integer columns with missing values as floats, e.g. 3.0
+		var f float64
+		f, err = strconv.ParseFloat(value, 64)
+		if err == nil && f != float64(int64(f)) {
+			err = fmt.Errorf("not an integer")
+		}
+	case TypeBoolean:
+		switch strings.ToLower(value) {
+		case "true", "false", "1", "0":
+		default:
+			err = fmt.Errorf("not a boolean")
+		}
+	case TypeDate:
+		_, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", c.Type, value)
+	}
+	return nil
+}
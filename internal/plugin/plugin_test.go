@@ -0,0 +1,208 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeManifest writes a processor manifest to <dir>/<dirName>/processor.yaml
+func writeManifest(t *testing.T, dir, dirName, doc string) string {
+	t.Helper()
+	path := filepath.Join(dir, dirName, ManifestFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			doc: `name: outlier_filter
+version: 2
+command: [python3, filter.py, --z, "3"]
+timeout_seconds: 60
+input:
+  columns:
+    - {name: product_id, type: string}
+    - {name: price, type: number}
+output:
+  columns:
+    - {name: price, type: number, nullable: true}
+`,
+		},
+		{name: "name with dash", doc: "name: outlier-filter\nversion: 1\ncommand: [./run.sh]\n", wantErr: "name must match"},
+		{name: "missing version", doc: "name: clip\ncommand: [./run.sh]\n", wantErr: "version must be positive"},
+		{name: "missing command", doc: "name: clip\nversion: 1\n", wantErr: "command is required"},
+		{name: "negative timeout", doc: "name: clip\nversion: 1\ncommand: [./run.sh]\ntimeout_seconds: -5\n", wantErr: "timeout_seconds must not be negative"},
+		{
+			name:    "unnamed input column",
+			doc:     "name: clip\nversion: 1\ncommand: [./run.sh]\ninput:\n  columns:\n    - {type: number}\n",
+			wantErr: "input: column name is required",
+		},
+		{
+			name:    "duplicate output column",
+			doc:     "name: clip\nversion: 1\ncommand: [./run.sh]\noutput:\n  columns:\n    - {name: price, type: number}\n    - {name: price, type: integer}\n",
+			wantErr: "output: duplicate column price",
+		},
+		{
+			name:    "unsupported type",
+			doc:     "name: clip\nversion: 1\ncommand: [./run.sh]\ninput:\n  columns:\n    - {name: price, type: float}\n",
+			wantErr: `input: column price has unsupported type "float"`,
+		},
+		{name: "not YAML", doc: "name: [clip\n", wantErr: "failed to parse processor manifest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			manifest, err := Load(writeManifest(t, dir, "processor", tt.doc))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() returned %v", err)
+			}
+			if manifest.Dir != filepath.Join(dir, "processor") {
+				t.Errorf("manifest dir = %s, want the manifest's directory", manifest.Dir)
+			}
+			if manifest.Timeout() != 60*time.Second {
+				t.Errorf("Timeout() = %s, want 1m0s", manifest.Timeout())
+			}
+		})
+	}
+}
+
+func TestExecutable(t *testing.T) {
+	tests := []struct {
+		program string
+		want    string
+	}{
+		{program: "python3", want: "python3"},
+		{program: "/usr/bin/python3", want: "/usr/bin/python3"},
+		{program: "./run.sh", want: "/opt/processors/outlier_filter/run.sh"},
+		{program: "bin/run", want: "/opt/processors/outlier_filter/bin/run"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.program, func(t *testing.T) {
+			manifest := &Manifest{Command: []string{tt.program}, Dir: "/opt/processors/outlier_filter"}
+			if got := manifest.Executable(); got != tt.want {
+				t.Fatalf("Executable() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaValidateCSV(t *testing.T) {
+	schema := Schema{Columns: []Column{
+		{Name: "product_id", Type: TypeString},
+		{Name: "price", Type: TypeNumber},
+		{Name: "quantity", Type: TypeInteger, Nullable: true},
+		{Name: "promo", Type: TypeBoolean},
+		{Name: "date", Type: TypeDate},
+	}}
+	header := "date,product_id,price,quantity,promo,extra\n"
+
+	tests := []struct {
+		name     string
+		content  string
+		wantRows int
+		wantErr  string
+	}{
+		{name: "valid", content: header + "2025-04-01,prd_a,10.5,3,true,x\n2025-04-02,prd_a,11,,0,y\n", wantRows: 2},
+		{name: "integer written as float", content: header + "2025-04-01,prd_a,10,3.0,false,x\n", wantRows: 1},
+		{name: "header only", content: header, wantRows: 0},
+		{name: "empty file", content: "", wantErr: "is empty"},
+		{name: "missing column", content: "date,product_id,price,quantity\n", wantErr: "has no promo column"},
+		{name: "empty required value", content: header + "2025-04-01,,10,3,true,x\n", wantErr: "column product_id: empty value"},
+		{name: "invalid number", content: header + "2025-04-01,prd_a,ten,3,true,x\n", wantErr: `invalid number "ten"`},
+		{name: "fractional integer", content: header + "2025-04-01,prd_a,10,3.5,true,x\n", wantErr: `invalid integer "3.5"`},
+		{name: "invalid boolean", content: header + "2025-04-01,prd_a,10,3,yes,x\n", wantErr: `invalid boolean "yes"`},
+		{name: "invalid date", content: header + "01.04.2025,prd_a,10,3,true,x\n", wantErr: `invalid date "01.04.2025"`},
+		{name: "error names the row", content: header + "2025-04-01,prd_a,10,3,true,x\n2025-04-02,prd_a,10,3,maybe,x\n", wantErr: "row 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "train_data.csv")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			rows, err := schema.ValidateCSV(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ValidateCSV() returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateCSV() returned %v", err)
+			}
+			if rows != tt.wantRows {
+				t.Fatalf("ValidateCSV() = %d rows, want %d", rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestLoadChain(t *testing.T) {
+	dir := t.TempDir()
+	writeManifest(t, dir, "dedup", "name: dedup\nversion: 1\ncommand: [./run.sh]\n")
+	writeManifest(t, dir, "clip", "name: clip\nversion: 1\ncommand: [./run.sh]\n")
+	writeManifest(t, dir, "renamed", "name: other\nversion: 1\ncommand: [./run.sh]\n")
+
+	tests := []struct {
+		name    string
+		names   []string
+		want    []string
+		wantErr string
+	}{
+		{name: "in order", names: []string{"clip", "dedup"}, want: []string{"clip", "dedup"}},
+		{name: "empty", names: nil},
+		{name: "chained twice", names: []string{"dedup", "dedup"}, wantErr: "processor dedup is chained twice"},
+		{name: "name mismatch", names: []string{"renamed"}, wantErr: "is named other"},
+		{name: "missing manifest", names: []string{"absent"}, wantErr: "failed to read processor manifest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := LoadChain(dir, tt.names)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadChain() returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadChain() returned %v", err)
+			}
+
+			var got []string
+			for _, manifest := range chain {
+				got = append(got, manifest.Name)
+				if manifest.Dir != filepath.Join(dir, manifest.Name) {
+					t.Errorf("manifest %s has dir %s", manifest.Name, manifest.Dir)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("LoadChain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package product
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Alias types that can be mapped to a product_id
+const (
+	AliasName          = "name"
+	AliasSKU           = "sku"
+	AliasMarketplaceID = "marketplace_id"
+)
+
+// Alias is a raw identifier of a product as it appears in incoming records
+type Alias struct {
+	Type  string
+	Value string
+}
+
+// Product is an entry of the products dimension
+type Product struct {
+	ID             string
+	CanonicalName  string
+	NormalizedName string
+	Brand          string
+	Category       string
+	Aliases        []Alias
+}
+
+// quoteReplacer removes straight and typographic quotes
+var quoteReplacer = strings.NewReplacer(
+	`"`, "", "'", "", "«", "", "»", "", "“", "", "”", "", "„", "", "‘", "", "’", "",
+)
+
+// NormalizeName applies the normalization rules used to match product names:
+// unicode NFKC, lower case, no quotes and single spaces between words
+func NormalizeName(name string) string {
+	name = norm.NFKC.String(name)
+	name = strings.ToLower(name)
+	name = quoteReplacer.Replace(name)
+	return strings.Join(strings.FieldsFunc(name, unicode.IsSpace), " ")
+}
+
+// NormalizeCode normalizes SKUs and marketplace identifiers
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(norm.NFKC.String(code)))
+}
+
+// RecordAliases extracts the aliases of a raw record in lookup priority order:
+// SKU, marketplace ID, then the normalized name
+func RecordAliases(record map[string]interface{}) []Alias {
+	var aliases []Alias
+
+	if sku := NormalizeCode(stringField(record, "sku")); sku != "" {
+		aliases = append(aliases, Alias{Type: AliasSKU, Value: sku})
+	}
+	if marketplaceID := NormalizeCode(stringField(record, "marketplace_id")); marketplaceID != "" {
+		aliases = append(aliases, Alias{Type: AliasMarketplaceID, Value: marketplaceID})
+	}
+	if name := NormalizeName(stringField(record, "product_name")); name != "" {
+		aliases = append(aliases, Alias{Type: AliasName, Value: name})
+	}
+
+	return aliases
+}
+
+// DefaultID derives a stable product_id for aliases that are not registered yet.
+// It is keyed on the SKU or marketplace ID; the normalized name is used only when
+// the record has no identifier, so products sharing a title are not merged.
+func DefaultID(aliases []Alias) string {
+	if len(aliases) == 0 {
+		return ""
+	}
+
+	key := aliases[0]
+	if identifiers := Identifiers(aliases); len(identifiers) > 0 {
+		key = identifiers[0]
+	}
+
+	sum := sha256.Sum256([]byte(key.Type + ":" + key.Value))
+	return "prd_" + hex.EncodeToString(sum[:8])
+}
+
+// Identifiers returns the SKU and marketplace ID aliases, leaving out the name
+func Identifiers(aliases []Alias) []Alias {
+	var identifiers []Alias
+	for _, alias := range aliases {
+		if alias.Type != AliasName {
+			identifiers = append(identifiers, alias)
+		}
+	}
+	return identifiers
+}
+
+// Resolve returns the product_id of a record's aliases given the registered ones.
+// A registered SKU or marketplace ID wins, in that order; a record with identifiers
+// none of which is registered gets a new ID even if its name is known. The name
+// resolves only records without identifiers. conflict reports identifiers
+// registered to different products.
+func Resolve(aliases []Alias, known map[Alias]string) (productID string, conflict bool) {
+	identifiers := Identifiers(aliases)
+	if len(identifiers) == 0 {
+		if len(aliases) == 0 {
+			return "", false
+		}
+		if id, ok := known[aliases[0]]; ok {
+			return id, false
+		}
+		return DefaultID(aliases), false
+	}
+
+	for _, alias := range identifiers {
+		id, ok := known[alias]
+		if !ok {
+			continue
+		}
+		if productID == "" {
+			productID = id
+		} else if id != productID {
+			conflict = true
+		}
+	}
+	if productID == "" {
+		productID = DefaultID(aliases)
+	}
+	return productID, conflict
+}
+
+// stringField returns a record field as a string; numeric identifiers are formatted without exponent
+func stringField(record map[string]interface{}, field string) string {
+	switch v := record[field].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,139 @@
+package product
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "lower case", in: "Apple iPhone 15", want: "apple iphone 15"},
+		{name: "collapsed spaces", in: "  Apple\t iPhone \n15 ", want: "apple iphone 15"},
+		{name: "typographic quotes", in: "Кофе «Jacobs» “Monarch”", want: "кофе jacobs monarch"},
+		{name: "straight quotes", in: `Chair "Oslo" 'Nordic'`, want: "chair oslo nordic"},
+		{name: "full width", in: "ＡＢＣ　１２３", want: "abc 123"},
+		{name: "empty", in: "   ", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeName(tt.in); got != tt.want {
+				t.Fatalf("NormalizeName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordAliases(t *testing.T) {
+	tests := []struct {
+		name   string
+		record map[string]interface{}
+		want   []Alias
+	}{
+		{
+			name:   "all identifiers in priority order",
+			record: map[string]interface{}{"product_name": "Chair Oslo", "marketplace_id": " wb-1 ", "sku": "ch-01"},
+			want: []Alias{
+				{Type: AliasSKU, Value: "CH-01"},
+				{Type: AliasMarketplaceID, Value: "WB-1"},
+				{Type: AliasName, Value: "chair oslo"},
+			},
+		},
+		{
+			name:   "numeric marketplace ID",
+			record: map[string]interface{}{"marketplace_id": float64(123456789012)},
+			want:   []Alias{{Type: AliasMarketplaceID, Value: "123456789012"}},
+		},
+		{
+			name:   "blank values",
+			record: map[string]interface{}{"sku": " ", "product_name": "", "marketplace_id": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RecordAliases(tt.record); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("RecordAliases() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultID(t *testing.T) {
+	sku := Alias{Type: AliasSKU, Value: "CH-01"}
+	marketplaceID := Alias{Type: AliasMarketplaceID, Value: "WB-1"}
+	name := Alias{Type: AliasName, Value: "chair oslo"}
+	otherName := Alias{Type: AliasName, Value: "chair bergen"}
+
+	tests := []struct {
+		name string
+		a    []Alias
+		b    []Alias
+		same bool
+	}{
+		{name: "keyed on sku, not name", a: []Alias{sku, name}, b: []Alias{sku, otherName}, same: true},
+		{name: "sku wins over marketplace ID", a: []Alias{sku, marketplaceID}, b: []Alias{sku}, same: true},
+		{name: "shared name, different identifiers", a: []Alias{sku, name}, b: []Alias{marketplaceID, name}, same: false},
+		{name: "name only", a: []Alias{name}, b: []Alias{name}, same: true},
+		{name: "different names", a: []Alias{name}, b: []Alias{otherName}, same: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := DefaultID(tt.a), DefaultID(tt.b)
+			if !strings.HasPrefix(a, "prd_") || len(a) != len("prd_")+16 {
+				t.Fatalf("DefaultID() = %q, want prd_ and 16 hex characters", a)
+			}
+			if (a == b) != tt.same {
+				t.Fatalf("DefaultID() = %q and %q, want same = %v", a, b, tt.same)
+			}
+		})
+	}
+
+	if got := DefaultID(nil); got != "" {
+		t.Fatalf("DefaultID(nil) = %q, want empty", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	sku := Alias{Type: AliasSKU, Value: "CH-01"}
+	marketplaceID := Alias{Type: AliasMarketplaceID, Value: "WB-1"}
+	name := Alias{Type: AliasName, Value: "chair oslo"}
+
+	tests := []struct {
+		name         string
+		aliases      []Alias
+		known        map[Alias]string
+		wantID       string
+		wantConflict bool
+	}{
+		{name: "no aliases", wantID: ""},
+		{name: "known sku", aliases: []Alias{sku, name}, known: map[Alias]string{sku: "prd_a"}, wantID: "prd_a"},
+		{name: "known marketplace ID", aliases: []Alias{sku, marketplaceID}, known: map[Alias]string{marketplaceID: "prd_b"}, wantID: "prd_b"},
+		{name: "sku wins", aliases: []Alias{sku, marketplaceID}, known: map[Alias]string{sku: "prd_a", marketplaceID: "prd_a"}, wantID: "prd_a"},
+		{
+			name:         "identifiers of different products",
+			aliases:      []Alias{sku, marketplaceID},
+			known:        map[Alias]string{sku: "prd_a", marketplaceID: "prd_b"},
+			wantID:       "prd_a",
+			wantConflict: true,
+		},
+		{name: "known name with unknown identifier", aliases: []Alias{sku, name}, known: map[Alias]string{name: "prd_c"}, wantID: DefaultID([]Alias{sku})},
+		{name: "known name only", aliases: []Alias{name}, known: map[Alias]string{name: "prd_c"}, wantID: "prd_c"},
+		{name: "unknown name only", aliases: []Alias{name}, wantID: DefaultID([]Alias{name})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, conflict := Resolve(tt.aliases, tt.known)
+			if id != tt.wantID || conflict != tt.wantConflict {
+				t.Fatalf("Resolve() = %q, %v, want %q, %v", id, conflict, tt.wantID, tt.wantConflict)
+			}
+		})
+	}
+}
@@ -81,3 +81,68 @@ func (c *Client) Close() {
 func (c *Client) Channel() *amqp.Channel {
 	return c.channel
 }
+
+// InspectQueue returns the message and consumer counts of an existing queue. A separate channel
+// is used, because a failed passive declare closes the channel it was sent on.
+func (c *Client) InspectQueue(queueName string) (amqp.Queue, error) {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	return ch.QueueDeclarePassive(
+		queueName, // name
+		true,      // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		nil,       // arguments
+	)
+}
+
+// PublishConfirmed publishes a persistent message on a channel in confirm mode and waits for the
+// broker to confirm it. Messages the broker cannot route are returned and reported as an error.
+func (c *Client) PublishConfirmed(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	returns := ch.NotifyReturn(make(chan amqp.Return, 1))
+
+	msg.DeliveryMode = amqp.Persistent
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		exchange,   // exchange
+		routingKey, // routing key
+		true,       // mandatory
+		false,      // immediate
+		msg,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for publisher confirm: %w", err)
+	}
+	if !acked {
+		return fmt.Errorf("message was not confirmed by the broker")
+	}
+
+	// A return is dispatched before the confirm of the same message
+	select {
+	case ret := <-returns:
+		return fmt.Errorf("message was returned as unroutable: %s", ret.ReplyText)
+	default:
+	}
+
+	c.logger.Infof("Published confirmed message to exchange %q with routing key %s", exchange, routingKey)
+	return nil
+}
@@ -0,0 +1,179 @@
+package schedule
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Window is a daily time range during which no run may start, e.g. 09:00-11:00.
+// A window whose end is before its start spans midnight.
+type Window struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// Schedule plans runs from a cron expression in a time zone, with optional jitter
+// and blackout windows
+type Schedule struct {
+	expr      string
+	cron      cron.Schedule
+	location  *time.Location
+	jitter    time.Duration
+	blackouts []Window
+}
+
+// New creates a schedule from a standard five-field cron expression or a descriptor
+// such as @daily or @every 6h. Blackout windows are given as HH:MM-HH:MM, comma-separated,
+// in the schedule's time zone.
+func New(expr string, timezone string, jitter time.Duration, blackouts string) (*Schedule, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scheduler time zone %q: %w", timezone, err)
+	}
+
+	parsed, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+
+	if jitter < 0 {
+		return nil, fmt.Errorf("scheduler jitter must not be negative")
+	}
+
+	windows, err := ParseWindows(blackouts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schedule{
+		expr:      expr,
+		cron:      parsed,
+		location:  location,
+		jitter:    jitter,
+		blackouts: windows,
+	}, nil
+}
+
+// ParseWindows parses comma-separated HH:MM-HH:MM blackout windows
+func ParseWindows(spec string) ([]Window, error) {
+	var windows []Window
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.Split(part, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid blackout window %q, expected HH:MM-HH:MM", part)
+		}
+		start, err := parseClock(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout window %q: %w", part, err)
+		}
+		end, err := parseClock(bounds[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout window %q: %w", part, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("blackout window %q is empty", part)
+		}
+
+		windows = append(windows, Window{start: start, end: end})
+	}
+	return windows, nil
+}
+
+// parseClock parses an HH:MM time of day
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// String describes the schedule
+func (s *Schedule) String() string {
+	description := fmt.Sprintf("%q in %s", s.expr, s.location)
+	if s.jitter > 0 {
+		description += fmt.Sprintf(", jitter %s", s.jitter)
+	}
+	for _, w := range s.blackouts {
+		description += fmt.Sprintf(", blackout %s", w)
+	}
+	return description
+}
+
+// Location returns the time zone of the schedule
+func (s *Schedule) Location() *time.Location {
+	return s.location
+}
+
+// Next returns the planned start of the first run after the given time: the next cron time
+// plus a random jitter, postponed to the end of any blackout window it falls into
+func (s *Schedule) Next(after time.Time) time.Time {
+	next := s.cron.Next(after.In(s.location))
+	if s.jitter > 0 {
+		next = next.Add(rand.N(s.jitter))
+	}
+
+	// Windows can overlap, so postpone until no window contains the start
+	for i := 0; i <= len(s.blackouts); i++ {
+		w, ok := s.Blackout(next)
+		if !ok {
+			break
+		}
+		next = w.endAfter(next)
+	}
+	return next
+}
+
+// Blackout returns the blackout window containing t, if any
+func (s *Schedule) Blackout(t time.Time) (Window, bool) {
+	t = t.In(s.location)
+	for _, w := range s.blackouts {
+		if w.contains(t) {
+			return w, true
+		}
+	}
+	return Window{}, false
+}
+
+// String formats the window as HH:MM-HH:MM
+func (w Window) String() string {
+	return fmt.Sprintf("%s-%s", formatClock(w.start), formatClock(w.end))
+}
+
+// formatClock formats a time of day as HH:MM
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// clock returns the time of day of t
+func clock(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+}
+
+// contains reports whether the time of day of t falls into the window
+func (w Window) contains(t time.Time) bool {
+	c := clock(t)
+	if w.start < w.end {
+		return c >= w.start && c < w.end
+	}
+	return c >= w.start || c < w.end
+}
+
+// endAfter returns the end of the window occurrence that contains t
+func (w Window) endAfter(t time.Time) time.Time {
+	day := t.Day()
+	if w.start > w.end && clock(t) >= w.start {
+		day++
+	}
+	return time.Date(t.Year(), t.Month(), day, int(w.end.Hours()), int(w.end.Minutes())%60, 0, 0, t.Location())
+}
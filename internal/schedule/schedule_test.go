@@ -0,0 +1,180 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		expr      string
+		timezone  string
+		jitter    time.Duration
+		blackouts string
+		wantErr   string
+	}{
+		{name: "cron expression", expr: "0 3 * * *", timezone: "Europe/Moscow"},
+		{name: "descriptor", expr: "@every 6h", timezone: "UTC"},
+		{name: "with blackouts", expr: "@hourly", timezone: "UTC", blackouts: "09:00-11:00, 23:30-01:00"},
+		{name: "invalid cron expression", expr: "0 3 * *", timezone: "UTC", wantErr: "invalid cron expression"},
+		{name: "invalid time zone", expr: "@daily", timezone: "Mars/Olympus", wantErr: "invalid scheduler time zone"},
+		{name: "negative jitter", expr: "@daily", timezone: "UTC", jitter: -time.Minute, wantErr: "jitter must not be negative"},
+		{name: "invalid blackout", expr: "@daily", timezone: "UTC", blackouts: "09:00", wantErr: "expected HH:MM-HH:MM"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.expr, tt.timezone, tt.jitter, tt.blackouts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("New() returned %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("New() returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty", spec: ""},
+		{name: "single", spec: "09:00-11:00", want: []string{"09:00-11:00"}},
+		{name: "several with spaces", spec: " 09:00-11:00 , 22:00-02:30,", want: []string{"09:00-11:00", "22:00-02:30"}},
+		{name: "missing end", spec: "09:00", wantErr: "expected HH:MM-HH:MM"},
+		{name: "invalid time", spec: "25:00-26:00", wantErr: `invalid time of day "25:00"`},
+		{name: "empty window", spec: "10:00-10:00", wantErr: "is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := ParseWindows(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseWindows() returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWindows() returned %v", err)
+			}
+
+			var got []string
+			for _, w := range windows {
+				got = append(got, w.String())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("ParseWindows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlackout(t *testing.T) {
+	s, err := New("@hourly", "UTC", 0, "09:00-11:00,23:00-01:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clock string
+		want  string
+	}{
+		{clock: "08:59", want: ""},
+		{clock: "09:00", want: "09:00-11:00"},
+		{clock: "10:59", want: "09:00-11:00"},
+		{clock: "11:00", want: ""},
+		{clock: "23:30", want: "23:00-01:00"},
+		{clock: "00:30", want: "23:00-01:00"},
+		{clock: "01:00", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.clock, func(t *testing.T) {
+			at, err := time.Parse("2006-01-02 15:04", "2025-04-01 "+tt.clock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, ok := s.Blackout(at)
+			got := ""
+			if ok {
+				got = w.String()
+			}
+			if got != tt.want {
+				t.Fatalf("Blackout(%s) = %q, want %q", tt.clock, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextSkipsBlackouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		expr      string
+		blackouts string
+		after     string
+		want      string
+	}{
+		{name: "outside blackout", expr: "0 3 * * *", blackouts: "09:00-11:00", after: "2025-04-01 00:00", want: "2025-04-01 03:00"},
+		{name: "postponed to window end", expr: "0 10 * * *", blackouts: "09:00-11:00", after: "2025-04-01 00:00", want: "2025-04-01 11:00"},
+		{name: "window over midnight", expr: "0 23 * * *", blackouts: "22:00-02:00", after: "2025-04-01 12:00", want: "2025-04-02 02:00"},
+		{name: "overlapping windows", expr: "0 10 * * *", blackouts: "09:00-11:00,10:30-12:00", after: "2025-04-01 00:00", want: "2025-04-01 12:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.expr, "UTC", 0, tt.blackouts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := time.Parse("2006-01-02 15:04", tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.Next(after).Format("2006-01-02 15:04")
+			if got != tt.want {
+				t.Fatalf("Next(%s) = %s, want %s", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextInTimeZone(t *testing.T) {
+	s, err := New("0 3 * * *", "Europe/Moscow", 0, "02:30-03:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 03:00 Moscow time falls into the blackout, which ends at 03:30 Moscow time (00:30 UTC)
+	after := time.Date(2025, 3, 31, 20, 0, 0, 0, time.UTC)
+	want := time.Date(2025, 4, 1, 0, 30, 0, 0, time.UTC)
+	if got := s.Next(after); !got.Equal(want) {
+		t.Fatalf("Next() = %s, want %s", got.UTC(), want)
+	}
+}
+
+func TestNextJitter(t *testing.T) {
+	s, err := New("0 3 * * *", "UTC", 10*time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	base := time.Date(2025, 4, 1, 3, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		got := s.Next(after)
+		if got.Before(base) || !got.Before(base.Add(10*time.Minute)) {
+			t.Fatalf("Next() = %s, want within 10m after %s", got, base)
+		}
+	}
+}
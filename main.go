@@ -8,7 +8,9 @@ import (
 	"go.uber.org/zap"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	_ "time/tzdata" // scheduler time zones do not depend on the image's zoneinfo
 )
 
 // @title Data Processor Service
@@ -34,19 +36,44 @@ func main() {
 	}
 	defer locator.Close()
 
+	// The scheduler stops first, the leader lock and the HTTP server are kept until the current run is drained
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	serveCtx, stopServing := context.WithCancel(context.Background())
+	defer stopServing()
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
-	sugar.Infof("Starting RabbitMQ controller with scheduler interval: %v", cfg.SchedulerInterval)
-	locator.RabbitMQController.StartProcessing(ctx, cfg.SchedulerInterval)
+	for _, pipeline := range locator.Pipelines {
+		if pipeline.Elector != nil {
+			pipeline.Elector.Run(serveCtx)
+		}
+		pipeline.RabbitMQController.StartProcessing(ctx)
+	}
+	locator.HTTPController.Start(serveCtx)
 
 	// Wait for termination signal
 	sig := <-sigCh
 	sugar.Infof("Received signal: %v, shutting down...", sig)
 
-	// Cancel context to stop the scheduler
+	// Stop scheduling new runs and let the current ones finish within the grace period
 	cancel()
+	var wg sync.WaitGroup
+	for _, pipeline := range locator.Pipelines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pipeline.RabbitMQController.Shutdown(cfg.ShutdownGracePeriod)
+		}()
+	}
+	wg.Wait()
+
+	// Release the leader locks only after the runs are drained, then close connections
+	stopServing()
+	for _, pipeline := range locator.Pipelines {
+		if pipeline.Elector != nil {
+			pipeline.Elector.Wait()
+		}
+	}
 }
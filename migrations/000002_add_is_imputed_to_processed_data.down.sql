@@ -0,0 +1,2 @@
+-- Drop is_imputed column
+ALTER TABLE processed_data DROP COLUMN IF EXISTS is_imputed;
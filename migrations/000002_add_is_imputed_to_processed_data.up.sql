@@ -0,0 +1,2 @@
+-- Flag rows synthesized by calendar gap filling
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS is_imputed BOOLEAN NOT NULL DEFAULT FALSE;
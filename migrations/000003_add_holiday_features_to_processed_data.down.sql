@@ -0,0 +1,3 @@
+-- Drop holiday calendar features
+ALTER TABLE processed_data DROP COLUMN IF EXISTS days_since_last_holiday;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS days_to_next_holiday;
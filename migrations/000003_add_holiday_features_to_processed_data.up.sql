@@ -0,0 +1,3 @@
+-- Add features computed from holiday calendars
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS days_to_next_holiday INT;
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS days_since_last_holiday INT;
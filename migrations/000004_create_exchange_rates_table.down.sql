@@ -0,0 +1,8 @@
+-- Drop currency audit columns
+ALTER TABLE processed_data DROP COLUMN IF EXISTS original_price_local;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS price_local;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS exchange_rate;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS currency;
+
+-- Drop exchange_rates table
+DROP TABLE IF EXISTS exchange_rates;
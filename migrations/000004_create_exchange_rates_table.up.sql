@@ -0,0 +1,16 @@
+-- Create exchange_rates table: rate is the price of one unit of currency in base_currency
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    date DATE NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    base_currency VARCHAR(3) NOT NULL,
+    rate DECIMAL NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (date, currency, base_currency)
+);
+
+-- Keep prices in the original currency for audit
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS currency VARCHAR(3);
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL;
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS price_local DECIMAL;
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS original_price_local DECIMAL;
@@ -0,0 +1,15 @@
+-- Restore product_name keyed processed_data
+DROP INDEX IF EXISTS idx_processed_data_product_id_date;
+DROP INDEX IF EXISTS idx_processed_data_key;
+DELETE FROM processed_data a USING processed_data b
+    WHERE a.id < b.id AND a.product_name = b.product_name AND a.date = b.date
+        AND a.region = b.region AND a.data_type = b.data_type;
+ALTER TABLE processed_data ALTER COLUMN product_name TYPE VARCHAR(255) USING left(product_name, 255);
+ALTER TABLE processed_data ADD CONSTRAINT processed_data_product_name_date_region_data_type_key
+    UNIQUE (product_name, date, region, data_type);
+CREATE INDEX IF NOT EXISTS idx_processed_data_product_date ON processed_data(product_name, date);
+ALTER TABLE processed_data DROP COLUMN IF EXISTS product_id;
+
+-- Drop products dimension
+DROP TABLE IF EXISTS product_aliases;
+DROP TABLE IF EXISTS products;
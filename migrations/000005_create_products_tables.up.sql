@@ -0,0 +1,29 @@
+-- Create products dimension
+CREATE TABLE IF NOT EXISTS products (
+    product_id TEXT PRIMARY KEY,
+    canonical_name TEXT NOT NULL,
+    normalized_name TEXT NOT NULL,
+    brand VARCHAR(100),
+    category VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Map raw names, SKUs and marketplace IDs to products
+CREATE TABLE IF NOT EXISTS product_aliases (
+    alias_type VARCHAR(32) NOT NULL, -- 'name', 'sku' or 'marketplace_id'
+    alias_value TEXT NOT NULL,
+    product_id TEXT NOT NULL REFERENCES products(product_id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (alias_type, alias_value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_aliases_product_id ON product_aliases(product_id);
+
+-- Key processed_data by product_id; product_name is kept untruncated for display
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS product_id TEXT;
+ALTER TABLE processed_data ALTER COLUMN product_name TYPE TEXT;
+ALTER TABLE processed_data DROP CONSTRAINT IF EXISTS processed_data_product_name_date_region_data_type_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_processed_data_key ON processed_data(product_id, date, region, data_type);
+
+DROP INDEX IF EXISTS idx_processed_data_product_date;
+CREATE INDEX IF NOT EXISTS idx_processed_data_product_id_date ON processed_data(product_id, date);
@@ -0,0 +1,9 @@
+-- Restore the fixed 7-day target columns
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS price_target DECIMAL;
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS sales_target DECIMAL;
+
+UPDATE processed_data
+SET price_target = (targets->>'price_target_h7')::DECIMAL,
+    sales_target = (targets->>'sales_target_h7')::DECIMAL;
+
+ALTER TABLE processed_data DROP COLUMN IF EXISTS targets;
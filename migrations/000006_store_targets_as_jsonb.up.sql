@@ -0,0 +1,13 @@
+-- Store a variable number of targets (one per name and horizon) in a JSONB map
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS targets JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- Carry the fixed 7-day targets over to the new naming scheme
+UPDATE processed_data
+SET targets = jsonb_strip_nulls(jsonb_build_object(
+    'price_target_h7', price_target,
+    'sales_target_h7', sales_target
+))
+WHERE targets = '{}'::jsonb;
+
+ALTER TABLE processed_data DROP COLUMN IF EXISTS price_target;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS sales_target;
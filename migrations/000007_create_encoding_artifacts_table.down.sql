@@ -0,0 +1,6 @@
+-- Drop encoded values and run id
+ALTER TABLE processed_data DROP COLUMN IF EXISTS run_id;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS encoded;
+
+-- Drop encoding_artifacts table
+DROP TABLE IF EXISTS encoding_artifacts;
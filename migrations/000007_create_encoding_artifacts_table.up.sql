@@ -0,0 +1,14 @@
+-- Create encoding_artifacts table: fitted categorical encoders per run
+CREATE TABLE IF NOT EXISTS encoding_artifacts (
+    run_id VARCHAR(32) NOT NULL,
+    column_name VARCHAR(100) NOT NULL,
+    method VARCHAR(16) NOT NULL, -- 'label', 'onehot' or 'target'
+    encoder JSONB NOT NULL,
+    spec_version INT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, column_name)
+);
+
+-- Encoded categorical values and the run that produced each row
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS encoded JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS run_id VARCHAR(32);
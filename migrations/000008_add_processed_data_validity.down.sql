@@ -0,0 +1,10 @@
+-- Keep only the current versions of processed rows
+DELETE FROM processed_data WHERE valid_to IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_processed_data_validity;
+DROP INDEX IF EXISTS idx_processed_data_current_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_processed_data_key ON processed_data(product_id, date, region, data_type);
+
+ALTER TABLE processed_data DROP COLUMN IF EXISTS row_hash;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS valid_to;
+ALTER TABLE processed_data DROP COLUMN IF EXISTS valid_from;
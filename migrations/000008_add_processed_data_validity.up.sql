@@ -0,0 +1,28 @@
+-- Keep every version of a processed row: a restated row closes the current version
+-- (valid_to) and is inserted as a new one, so datasets can be rebuilt as of a past time
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS valid_from TIMESTAMP WITH TIME ZONE;
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS valid_to TIMESTAMP WITH TIME ZONE;
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS row_hash VARCHAR(64);
+
+UPDATE processed_data SET valid_from = COALESCE(created_at, CURRENT_TIMESTAMP) WHERE valid_from IS NULL;
+ALTER TABLE processed_data ALTER COLUMN valid_from SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE processed_data ALTER COLUMN valid_from SET NOT NULL;
+
+-- A row is versioned per (product_id, date, region) whichever split it is in, so rows
+-- of a key kept in several splits are closed except for the latest one
+WITH latest AS (
+    SELECT DISTINCT ON (product_id, date, region) id, product_id, date, region, valid_from
+    FROM processed_data
+    ORDER BY product_id, date, region, valid_from DESC, id DESC
+)
+UPDATE processed_data p SET valid_to = latest.valid_from
+FROM latest
+WHERE p.product_id = latest.product_id AND p.date = latest.date
+    AND p.region = latest.region AND p.id <> latest.id;
+
+-- Only the current version of a row is unique
+DROP INDEX IF EXISTS idx_processed_data_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_processed_data_current_key
+    ON processed_data(product_id, date, region) WHERE valid_to IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_processed_data_validity ON processed_data(valid_from, valid_to);
@@ -0,0 +1,2 @@
+-- Drop cross-validation fold id
+ALTER TABLE processed_data DROP COLUMN IF EXISTS fold_id;
@@ -0,0 +1,2 @@
+-- Cross-validation fold whose test window contains the row (-1 when the row is in no test window)
+ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS fold_id INT NOT NULL DEFAULT -1;
@@ -0,0 +1,2 @@
+-- Drop scaler_params table
+DROP TABLE IF EXISTS scaler_params;
@@ -0,0 +1,12 @@
+-- Create scaler_params table: scaling parameters fitted on the training split per run
+CREATE TABLE IF NOT EXISTS scaler_params (
+    run_id VARCHAR(32) NOT NULL,
+    column_name VARCHAR(100) NOT NULL,
+    method VARCHAR(16) NOT NULL, -- 'standard', 'minmax' or 'robust'
+    center DOUBLE PRECISION NOT NULL,
+    scale DOUBLE PRECISION NOT NULL,
+    stats JSONB NOT NULL DEFAULT '{}'::jsonb,
+    spec_version INT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, column_name)
+);
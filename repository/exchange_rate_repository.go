@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ExchangeRate is the daily rate of a currency expressed in the base currency
+type ExchangeRate struct {
+	Date     string  `json:"date"`
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+}
+
+// ExchangeRateRepository loads daily exchange rates from a CSV file or an HTTP source
+type ExchangeRateRepository struct {
+	filePath   string
+	url        string
+	httpClient *http.Client
+	logger     *zap.SugaredLogger
+}
+
+// NewExchangeRateRepository creates a new ExchangeRateRepository instance
+func NewExchangeRateRepository(filePath string, url string, logger *zap.SugaredLogger) *ExchangeRateRepository {
+	return &ExchangeRateRepository{
+		filePath:   filePath,
+		url:        url,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		logger:     logger,
+	}
+}
+
+// Configured reports whether any exchange rate source is set
+func (r *ExchangeRateRepository) Configured() bool {
+	return r.filePath != "" || r.url != ""
+}
+
+// LoadRates loads exchange rates from all configured sources
+func (r *ExchangeRateRepository) LoadRates(ctx context.Context) ([]ExchangeRate, error) {
+	var rates []ExchangeRate
+
+	if r.filePath != "" {
+		fileRates, err := r.loadFromFile()
+		if err != nil {
+			return nil, err
+		}
+		r.logger.Infof("Loaded %d exchange rates from %s", len(fileRates), r.filePath)
+		rates = append(rates, fileRates...)
+	}
+
+	if r.url != "" {
+		apiRates, err := r.loadFromURL(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.logger.Infof("Loaded %d exchange rates from %s", len(apiRates), r.url)
+		rates = append(rates, apiRates...)
+	}
+
+	return rates, nil
+}
+
+// loadFromFile reads rates from a CSV file with date, currency and rate columns
+func (r *ExchangeRateRepository) loadFromFile() ([]ExchangeRate, error) {
+	file, err := os.Open(r.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exchange rates file %s: %w", r.filePath, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates header: %w", err)
+	}
+
+	colIndices := make(map[string]int)
+	for i, colName := range header {
+		colIndices[strings.TrimSpace(colName)] = i
+	}
+	for _, required := range []string{"date", "currency", "rate"} {
+		if _, ok := colIndices[required]; !ok {
+			return nil, fmt.Errorf("exchange rates file is missing column %s", required)
+		}
+	}
+
+	var rates []ExchangeRate
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading exchange rate row: %w", err)
+		}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(row[colIndices["rate"]]), 64)
+		if err != nil || rate <= 0 {
+			r.logger.Warnf("Skipping invalid exchange rate row: %v", row)
+			continue
+		}
+
+		rates = append(rates, ExchangeRate{
+			Date:     strings.TrimSpace(row[colIndices["date"]]),
+			Currency: strings.ToUpper(strings.TrimSpace(row[colIndices["currency"]])),
+			Rate:     rate,
+		})
+	}
+
+	return rates, nil
+}
+
+// loadFromURL fetches rates as a JSON array of {date, currency, rate} objects
+func (r *ExchangeRateRepository) loadFromURL(ctx context.Context) ([]ExchangeRate, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exchange rates request: %w", err)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rates source returned status %d", resp.StatusCode)
+	}
+
+	var rates []ExchangeRate
+	if err := json.NewDecoder(resp.Body).Decode(&rates); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+
+	for i := range rates {
+		rates[i].Currency = strings.ToUpper(strings.TrimSpace(rates[i].Currency))
+	}
+
+	return rates, nil
+}
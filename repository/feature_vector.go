@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/featurespec"
+)
+
+// FeatureKey identifies a product series served to the ML service
+type FeatureKey struct {
+	ProductID string `json:"product_id"`
+	Region    string `json:"region"`
+}
+
+// FeatureVector is the latest processed row of a series with all model inputs
+type FeatureVector struct {
+	ProductID  string              `json:"product_id"`
+	Region     string              `json:"region"`
+	Date       string              `json:"date"`
+	RunID      string              `json:"run_id,omitempty"`
+	Attributes map[string]string   `json:"attributes"`
+	Features   map[string]*float64 `json:"features"`
+}
+
+// Key returns the series key of the vector
+func (v FeatureVector) Key() FeatureKey {
+	return FeatureKey{ProductID: v.ProductID, Region: v.Region}
+}
+
+// servingAttributeColumns are the descriptive columns returned alongside the features
+var servingAttributeColumns = []string{"product_name", "brand", "category", "seller"}
+
+// servingBaseColumns are the numeric processed_data columns that are part of every feature vector
+var servingBaseColumns = []string{
+	"sales_quantity", "price", "original_price", "discount_percentage", "stock_level",
+	"customer_rating", "review_count", "delivery_days",
+	"day_of_week", "month", "quarter", "days_to_next_holiday", "days_since_last_holiday",
+	"exchange_rate",
+}
+
+// servingBoolColumns are the boolean processed_data columns served as 0 or 1
+var servingBoolColumns = []string{"is_weekend", "is_holiday", "is_imputed"}
+
+// LoadLatestFeatureVectors reads the latest row of every series from processed CSV files
+func (r *FileRepository) LoadLatestFeatureVectors(filePaths []string, spec *featurespec.Spec) ([]FeatureVector, error) {
+	latest := make(map[FeatureKey]FeatureVector)
+
+	for _, filePath := range filePaths {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			continue
+		}
+		if err := r.readLatestFeatureVectors(filePath, spec, latest); err != nil {
+			return nil, err
+		}
+	}
+
+	vectors := make([]FeatureVector, 0, len(latest))
+	for _, vector := range latest {
+		vectors = append(vectors, vector)
+	}
+	return vectors, nil
+}
+
+// readLatestFeatureVectors keeps the row with the latest date of every series found in a CSV file
+func (r *FileRepository) readLatestFeatureVectors(filePath string, spec *featurespec.Spec, latest map[FeatureKey]FeatureVector) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header of %s: %w", filePath, err)
+	}
+
+	colIndices := make(map[string]int)
+	var encodedColumns []string
+	for i, colName := range header {
+		colIndices[colName] = i
+		if spec.IsEncodedColumn(colName) {
+			encodedColumns = append(encodedColumns, colName)
+		}
+	}
+
+	numericColumns := append(append(append([]string(nil), servingBaseColumns...), spec.FeatureColumns()...), encodedColumns...)
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading row of %s: %w", filePath, err)
+		}
+
+		vector := FeatureVector{
+			ProductID:  parseString(row, colIndices, "product_id").(string),
+			Region:     parseString(row, colIndices, "region").(string),
+			Date:       parseString(row, colIndices, "date").(string),
+			Attributes: make(map[string]string, len(servingAttributeColumns)),
+			Features:   make(map[string]*float64, len(numericColumns)+len(servingBoolColumns)),
+		}
+		if vector.ProductID == "" {
+			continue
+		}
+		if current, ok := latest[vector.Key()]; ok && current.Date >= vector.Date {
+			continue
+		}
+
+		for _, col := range servingAttributeColumns {
+			vector.Attributes[col] = parseString(row, colIndices, col).(string)
+		}
+		for _, col := range numericColumns {
+			if val, ok := parseNullableDecimal(row, colIndices, col).(float64); ok {
+				vector.Features[col] = &val
+			} else {
+				vector.Features[col] = nil
+			}
+		}
+		for _, col := range servingBoolColumns {
+			val := 0.0
+			if parseBool(row, colIndices, col).(bool) {
+				val = 1
+			}
+			vector.Features[col] = &val
+		}
+
+		latest[vector.Key()] = vector
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// FileLock is not supported on this platform; acquiring it always fails
+type FileLock struct {
+	path string
+}
+
+// NewFileLock creates a lock on the file at path
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// TryAcquire always fails because flock is not available
+func (l *FileLock) TryAcquire(ctx context.Context) (bool, error) {
+	return false, fmt.Errorf("file locks are not supported on this platform")
+}
+
+// Check always fails because the lock is never held
+func (l *FileLock) Check(ctx context.Context) error {
+	return fmt.Errorf("file lock is not held")
+}
+
+// Release does nothing
+func (l *FileLock) Release() {}
+
+// String describes the lock
+func (l *FileLock) String() string {
+	return fmt.Sprintf("file lock %s", l.path)
+}
@@ -1,10 +1,15 @@
 package repository
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 )
 
 // FileRepository handles file operations
@@ -46,6 +51,171 @@ func (r *FileRepository) SaveMarketplaceData(data []map[string]interface{}, file
 	return nil
 }
 
+// SaveJSON saves any value to an indented JSON file
+func (r *FileRepository) SaveJSON(v interface{}, filePath string) error {
+	// Create directory if it doesn't exist
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// SaveExchangeRates saves exchange rates to a CSV file for the Python processor
+func (r *FileRepository) SaveExchangeRates(rates []ExchangeRate, filePath string) error {
+	// Create directory if it doesn't exist
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"date", "currency", "rate"}); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	for _, rate := range rates {
+		row := []string{rate.Date, rate.Currency, strconv.FormatFloat(rate.Rate, 'f', -1, 64)}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// LoadJSON reads a JSON file into the given value
+func (r *FileRepository) LoadJSON(filePath string, v interface{}) error {
+	jsonData, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if err := json.Unmarshal(jsonData, v); err != nil {
+		return fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+
+	return nil
+}
+
+// CSVSummary describes the shape and date range of a CSV file
+type CSVSummary struct {
+	Header []string `json:"-"`
+	Rows   int      `json:"rows"`
+	// DateFrom and DateTo are the first and last YYYY-MM-DD dates of the date column
+	DateFrom string `json:"date_from,omitempty"`
+	DateTo   string `json:"date_to,omitempty"`
+}
+
+// InspectCSV returns the header, the number of data rows and the range of the date column of a CSV file
+func (r *FileRepository) InspectCSV(filePath string, dateColumn string) (*CSVSummary, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	dateIndex := -1
+	for i, col := range header {
+		if col == dateColumn {
+			dateIndex = i
+		}
+	}
+
+	summary := &CSVSummary{Header: header}
+	for {
+		row, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read row %d: %w", summary.Rows+1, err)
+		}
+		summary.Rows++
+
+		if dateIndex < 0 || dateIndex >= len(row) || len(row[dateIndex]) < len("2006-01-02") {
+			continue
+		}
+		date := row[dateIndex][:len("2006-01-02")]
+		if summary.DateFrom == "" || date < summary.DateFrom {
+			summary.DateFrom = date
+		}
+		if date > summary.DateTo {
+			summary.DateTo = date
+		}
+	}
+
+	return summary, nil
+}
+
+// GetRunPath returns the directory keeping the state and stage outputs of a pipeline run.
+// The directory is created when the first file is saved to it.
+func (r *FileRepository) GetRunPath(runID string) string {
+	return filepath.Join(r.baseDataPath, "runs", runID)
+}
+
+// RunExists reports whether the directory of a pipeline run exists
+func (r *FileRepository) RunExists(runID string) bool {
+	_, err := os.Stat(r.GetRunPath(runID))
+	return err == nil
+}
+
+// ListRuns returns the IDs of the pipeline runs kept on disk, oldest first
+func (r *FileRepository) ListRuns() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(r.baseDataPath, "runs"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read runs directory: %w", err)
+	}
+
+	var runIDs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			runIDs = append(runIDs, entry.Name())
+		}
+	}
+	// Run IDs are timestamps, so lexical order is chronological, with or without milliseconds
+	sort.Strings(runIDs)
+
+	return runIDs, nil
+}
+
+// RemoveRun deletes the directory of a pipeline run
+func (r *FileRepository) RemoveRun(runID string) error {
+	if err := os.RemoveAll(r.GetRunPath(runID)); err != nil {
+		return fmt.Errorf("failed to remove run directory: %w", err)
+	}
+	return nil
+}
+
 // GetProcessedDataPath returns the path to the processed data directory
 func (r *FileRepository) GetProcessedDataPath() string {
 	processedPath := filepath.Join(r.baseDataPath, "processed")
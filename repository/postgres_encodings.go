@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EncodingArtifacts are the categorical encoders fitted during one run
+type EncodingArtifacts struct {
+	RunID       string                     `json:"run_id"`
+	SpecVersion int                        `json:"spec_version"`
+	CreatedAt   string                     `json:"created_at"`
+	Encoders    map[string]json.RawMessage `json:"encoders"`
+}
+
+// SaveEncodingArtifacts stores the fitted encoders of a run
+func (r *PostgresRepository) SaveEncodingArtifacts(artifacts *EncodingArtifacts) error {
+	batch := &pgx.Batch{}
+	for column, encoder := range artifacts.Encoders {
+		var meta struct {
+			Method string `json:"method"`
+		}
+		if err := json.Unmarshal(encoder, &meta); err != nil {
+			return fmt.Errorf("failed to parse encoder of column %s: %v", column, err)
+		}
+
+		batch.Queue(`
+			INSERT INTO encoding_artifacts (run_id, column_name, method, encoder, spec_version)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (run_id, column_name) DO UPDATE SET
+				method = EXCLUDED.method,
+				encoder = EXCLUDED.encoder,
+				spec_version = EXCLUDED.spec_version
+		`, artifacts.RunID, column, meta.Method, string(encoder), artifacts.SpecVersion)
+	}
+
+	if err := r.pool.SendBatch(context.Background(), batch).Close(); err != nil {
+		return fmt.Errorf("error saving encoding artifacts: %v", err)
+	}
+
+	r.logger.Infof("Saved %d encoders of run %s to the database", len(artifacts.Encoders), artifacts.RunID)
+	return nil
+}
+
+// GetEncodingArtifacts returns the encoders of a run, or of the latest run when runID is empty.
+// It returns nil when no encoders are stored for the run.
+func (r *PostgresRepository) GetEncodingArtifacts(runID string) (*EncodingArtifacts, error) {
+	if runID == "" {
+		err := r.pool.QueryRow(context.Background(),
+			`SELECT run_id FROM encoding_artifacts ORDER BY created_at DESC, run_id DESC LIMIT 1`,
+		).Scan(&runID)
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query latest encoding run: %v", err)
+		}
+	}
+
+	rows, err := r.pool.Query(context.Background(), `
+		SELECT column_name, encoder::text, spec_version, to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SS')
+		FROM encoding_artifacts
+		WHERE run_id = $1
+	`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query encoding artifacts: %v", err)
+	}
+	defer rows.Close()
+
+	artifacts := &EncodingArtifacts{RunID: runID, Encoders: make(map[string]json.RawMessage)}
+	for rows.Next() {
+		var column, encoder string
+		if err := rows.Scan(&column, &encoder, &artifacts.SpecVersion, &artifacts.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan encoding artifact: %v", err)
+		}
+		artifacts.Encoders[column] = json.RawMessage(encoder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(artifacts.Encoders) == 0 {
+		return nil, nil
+	}
+	return artifacts, nil
+}
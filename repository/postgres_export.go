@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/featurespec"
+	"github.com/jackc/pgx/v5"
+)
+
+// processedDataBoolColumns are exported in the same format as the processed CSV files
+var processedDataBoolColumns = map[string]bool{"is_weekend": true, "is_holiday": true, "is_imputed": true}
+
+// ExportProcessedDataAsOf writes the processed rows as they were known at asOf to w as CSV.
+// Targets are expanded into one column each; an empty dataType exports every split.
+// It returns the number of exported rows.
+func (r *PostgresRepository) ExportProcessedDataAsOf(w io.Writer, asOf time.Time, dataType string, spec *featurespec.Spec) (int, error) {
+	var header, selects []string
+	for _, col := range baseProcessedDataColumns {
+		name := pgx.Identifier{col.name}.Sanitize()
+		header = append(header, col.name)
+		switch {
+		case col.name == "date":
+			selects = append(selects, "to_char(date, 'YYYY-MM-DD')")
+		case processedDataBoolColumns[col.name]:
+			selects = append(selects, fmt.Sprintf("CASE WHEN %s THEN 'True' ELSE 'False' END", name))
+		default:
+			selects = append(selects, name+"::text")
+		}
+	}
+	for _, col := range spec.FeatureColumns() {
+		header = append(header, col)
+		selects = append(selects, pgx.Identifier{col}.Sanitize()+"::text")
+	}
+	for i, col := range spec.TargetColumns() {
+		header = append(header, col)
+		selects = append(selects, fmt.Sprintf("targets ->> $%d", i+3))
+	}
+	header = append(header, "encoded", "data_type", "run_id", "valid_from", "valid_to")
+	selects = append(selects, "encoded::text", "data_type", "run_id",
+		`to_char(valid_from, 'YYYY-MM-DD"T"HH24:MI:SSOF')`, `to_char(valid_to, 'YYYY-MM-DD"T"HH24:MI:SSOF')`)
+
+	// A version is visible when it was loaded before asOf and not yet replaced at asOf
+	sql := fmt.Sprintf(`
+		SELECT %s
+		FROM processed_data
+		WHERE valid_from <= $1 AND (valid_to IS NULL OR valid_to > $1)
+			AND ($2 = '' OR data_type = $2)
+		ORDER BY data_type, product_id, region, date
+	`, strings.Join(selects, ", "))
+
+	args := []interface{}{asOf, dataType}
+	for _, col := range spec.TargetColumns() {
+		args = append(args, col)
+	}
+
+	rows, err := r.pool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query processed data as of %s: %v", asOf.Format(time.RFC3339), err)
+	}
+	defer rows.Close()
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return 0, fmt.Errorf("failed to write export header: %v", err)
+	}
+
+	values := make([]*string, len(header))
+	dest := make([]interface{}, len(header))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(header))
+
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return count, fmt.Errorf("failed to scan processed row: %v", err)
+		}
+		for i, val := range values {
+			record[i] = ""
+			if val != nil {
+				record[i] = *val
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return count, fmt.Errorf("failed to write processed row: %v", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	writer.Flush()
+	return count, writer.Error()
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/featurespec"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetLatestFeatureVectors returns the latest processed row of every series with its feature columns
+// and categorical encodings
+func (r *PostgresRepository) GetLatestFeatureVectors(spec *featurespec.Spec) ([]FeatureVector, error) {
+	numericColumns := append(append([]string(nil), servingBaseColumns...), spec.FeatureColumns()...)
+
+	selects := []string{"product_id", "region", "to_char(date, 'YYYY-MM-DD')", "COALESCE(run_id, '')"}
+	for _, col := range servingAttributeColumns {
+		selects = append(selects, pgx.Identifier{col}.Sanitize())
+	}
+	for _, col := range numericColumns {
+		selects = append(selects, pgx.Identifier{col}.Sanitize()+"::float8")
+	}
+	for _, col := range servingBoolColumns {
+		selects = append(selects, pgx.Identifier{col}.Sanitize()+"::int::float8")
+	}
+	selects = append(selects, "encoded::text")
+
+	// The current version of the row with the latest date of a series
+	sql := fmt.Sprintf(`
+		SELECT DISTINCT ON (product_id, region) %s
+		FROM processed_data
+		WHERE product_id IS NOT NULL AND valid_to IS NULL
+		ORDER BY product_id, region, date DESC, valid_from DESC
+	`, strings.Join(selects, ", "))
+
+	rows, err := r.pool.Query(context.Background(), sql)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest feature vectors: %v", err)
+	}
+	defer rows.Close()
+
+	var vectors []FeatureVector
+	for rows.Next() {
+		vector := FeatureVector{
+			Attributes: make(map[string]string, len(servingAttributeColumns)),
+			Features:   make(map[string]*float64, len(numericColumns)+len(servingBoolColumns)),
+		}
+
+		attributes := make([]string, len(servingAttributeColumns))
+		values := make([]*float64, len(numericColumns)+len(servingBoolColumns))
+		var encoded string
+
+		dest := []interface{}{&vector.ProductID, &vector.Region, &vector.Date, &vector.RunID}
+		for i := range attributes {
+			dest = append(dest, &attributes[i])
+		}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &encoded)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan feature vector: %v", err)
+		}
+
+		for i, col := range servingAttributeColumns {
+			vector.Attributes[col] = attributes[i]
+		}
+		for i, col := range append(append([]string(nil), numericColumns...), servingBoolColumns...) {
+			vector.Features[col] = values[i]
+		}
+
+		var encodedValues map[string]float64
+		if err := json.Unmarshal([]byte(encoded), &encodedValues); err != nil {
+			return nil, fmt.Errorf("failed to parse encoded values: %v", err)
+		}
+		for col, val := range encodedValues {
+			vector.Features[col] = &val
+		}
+
+		vectors = append(vectors, vector)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return vectors, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AdvisoryLock is a session-level PostgreSQL advisory lock. It is held by a dedicated
+// pool connection, so it is released by the server as soon as that session drops.
+type AdvisoryLock struct {
+	pool *pgxpool.Pool
+	key  int64
+	conn *pgxpool.Conn
+}
+
+// NewAdvisoryLock creates an advisory lock on the given key
+func (r *PostgresRepository) NewAdvisoryLock(key int64) *AdvisoryLock {
+	return &AdvisoryLock{pool: r.pool, key: key}
+}
+
+// TryAcquire takes the lock without waiting
+func (l *AdvisoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %v", err)
+	}
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&locked); err != nil {
+		conn.Release()
+		return false, fmt.Errorf("failed to take advisory lock: %v", err)
+	}
+	if !locked {
+		conn.Release()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+// Check verifies that the session holding the lock is still alive
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	if l.conn == nil {
+		return fmt.Errorf("advisory lock is not held")
+	}
+	if err := l.conn.Ping(ctx); err != nil {
+		return fmt.Errorf("advisory lock session dropped: %v", err)
+	}
+	return nil
+}
+
+// Release unlocks the lock and returns its connection to the pool
+func (l *AdvisoryLock) Release() {
+	if l.conn == nil {
+		return
+	}
+
+	// A connection that cannot unlock is closed, which ends the session and its locks
+	if _, err := l.conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		l.conn.Conn().Close(context.Background())
+	}
+	l.conn.Release()
+	l.conn = nil
+}
+
+// String describes the lock
+func (l *AdvisoryLock) String() string {
+	return fmt.Sprintf("PostgreSQL advisory lock %d", l.key)
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/product"
+	"github.com/jackc/pgx/v5"
+)
+
+// ResolveProductAliases returns the product_id registered for each of the given aliases
+func (r *PostgresRepository) ResolveProductAliases(aliases []product.Alias) (map[product.Alias]string, error) {
+	resolved := make(map[product.Alias]string)
+	if len(aliases) == 0 {
+		return resolved, nil
+	}
+
+	types := make([]string, len(aliases))
+	values := make([]string, len(aliases))
+	for i, alias := range aliases {
+		types[i] = alias.Type
+		values[i] = alias.Value
+	}
+
+	rows, err := r.pool.Query(context.Background(), `
+		SELECT a.alias_type, a.alias_value, a.product_id
+		FROM product_aliases a
+		JOIN unnest($1::text[], $2::text[]) AS q(alias_type, alias_value)
+			ON a.alias_type = q.alias_type AND a.alias_value = q.alias_value
+	`, types, values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query product aliases: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias product.Alias
+		var productID string
+		if err := rows.Scan(&alias.Type, &alias.Value, &productID); err != nil {
+			return nil, fmt.Errorf("failed to scan product alias: %v", err)
+		}
+		resolved[alias] = productID
+	}
+
+	return resolved, rows.Err()
+}
+
+// RegisterProducts stores new products and their aliases; existing alias mappings are kept
+func (r *PostgresRepository) RegisterProducts(products []product.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	tx, err := r.pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	batch := &pgx.Batch{}
+	for _, p := range products {
+		batch.Queue(`
+			INSERT INTO products (product_id, canonical_name, normalized_name, brand, category)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (product_id) DO NOTHING
+		`, p.ID, p.CanonicalName, p.NormalizedName, p.Brand, p.Category)
+
+		for _, alias := range p.Aliases {
+			batch.Queue(`
+				INSERT INTO product_aliases (alias_type, alias_value, product_id)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (alias_type, alias_value) DO NOTHING
+			`, alias.Type, alias.Value, p.ID)
+		}
+	}
+
+	if err := tx.SendBatch(context.Background(), batch).Close(); err != nil {
+		return fmt.Errorf("error registering products: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	r.logger.Infof("Registered %d new products", len(products))
+	return nil
+}
+
+// GetProductNamesWithoutID returns product names of processed rows stored before product_id existed
+func (r *PostgresRepository) GetProductNamesWithoutID() ([]string, error) {
+	rows, err := r.pool.Query(context.Background(),
+		`SELECT DISTINCT product_name FROM processed_data WHERE product_id IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query product names: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan product name: %v", err)
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// SetProductIDByName assigns a product_id to processed rows that only have a product name.
+// One current row per date and region stays current, the latest one, unless a row keyed
+// by the product already exists there; the other current rows of the name are closed.
+func (r *PostgresRepository) SetProductIDByName(productName string, productID string) (int64, error) {
+	tag, err := r.pool.Exec(context.Background(), `
+		WITH kept AS (
+			SELECT DISTINCT ON (p.date, p.region) p.id
+			FROM processed_data p
+			WHERE p.product_name = $1 AND p.product_id IS NULL AND p.valid_to IS NULL
+				AND NOT EXISTS (
+					SELECT 1 FROM processed_data o
+					WHERE o.product_id = $2 AND o.date = p.date
+						AND o.region = p.region AND o.valid_to IS NULL
+				)
+			ORDER BY p.date, p.region, p.valid_from DESC, p.id DESC
+		)
+		UPDATE processed_data p SET
+			product_id = $2,
+			valid_to = CASE
+				WHEN p.valid_to IS NULL AND p.id NOT IN (SELECT id FROM kept)
+				THEN GREATEST(CURRENT_TIMESTAMP, p.valid_from)
+				ELSE p.valid_to
+			END
+		WHERE p.product_name = $1 AND p.product_id IS NULL
+	`, productName, productID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set product_id: %v", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// newMigratedRepository returns a repository on a fresh schema with every migration applied.
+// It needs TEST_POSTGRES_CONN, a connection string such as "host=localhost user=postgres dbname=test".
+func newMigratedRepository(t *testing.T) *PostgresRepository {
+	t.Helper()
+	conn := os.Getenv("TEST_POSTGRES_CONN")
+	if conn == "" {
+		t.Skip("TEST_POSTGRES_CONN is not set")
+	}
+	// Migrations are read from ./migrations
+	t.Chdir("..")
+
+	logger := zap.NewNop().Sugar()
+	base, err := NewPostgresRepository(conn, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if err := base.EnsureSchema(schema); err != nil {
+		base.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		base.pool.Exec(context.Background(), "DROP SCHEMA "+pgx.Identifier{schema}.Sanitize()+" CASCADE")
+		base.Close()
+	})
+
+	repo, err := NewPostgresRepository(conn+" search_path="+schema, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(repo.Close)
+	if err := repo.RunMigrations("test"); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestSetProductIDByName(t *testing.T) {
+	repo := newMigratedRepository(t)
+	ctx := context.Background()
+
+	insert := func(productID interface{}, date, dataType string, validFrom time.Time) int {
+		t.Helper()
+		var id int
+		err := repo.pool.QueryRow(ctx, `
+			INSERT INTO processed_data (
+				product_id, product_name, date, region, brand, category, sales_quantity, price,
+				original_price, discount_percentage, stock_level, customer_rating, review_count,
+				delivery_days, seller, is_weekend, is_holiday, day_of_week, month, quarter,
+				data_type, valid_from
+			) VALUES ($1, 'Chair Oslo', $2, 'msk', 'nordic', 'furniture', 1, 10, 10, 0, 5, 4.5, 10,
+				2, 'shop', false, false, 1, 4, 2, $3, $4)
+			RETURNING id
+		`, productID, date, dataType, validFrom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	loaded := time.Date(2025, 4, 10, 0, 0, 0, 0, time.UTC)
+	// Legacy rows of one date in two splits
+	insert(nil, "2025-04-01", "train", loaded)
+	latest := insert(nil, "2025-04-01", "test", loaded.Add(time.Hour))
+	// A legacy row next to a row already keyed by the product in another split
+	keyed := insert("prd_chair", "2025-04-02", "train", loaded)
+	insert(nil, "2025-04-02", "test", loaded)
+
+	count, err := repo.SetProductIDByName("Chair Oslo", "prd_chair")
+	if err != nil {
+		t.Fatalf("SetProductIDByName() returned %v", err)
+	}
+	if count != 3 {
+		t.Errorf("SetProductIDByName() updated %d rows, want 3", count)
+	}
+
+	rows, err := repo.pool.Query(ctx, `
+		SELECT id FROM processed_data
+		WHERE product_id = 'prd_chair' AND valid_to IS NULL
+		ORDER BY date
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 2 || current[0] != latest || current[1] != keyed {
+		t.Errorf("current rows = %v, want [%d %d]", current, latest, keyed)
+	}
+
+	names, err := repo.GetProductNamesWithoutID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("rows without product_id left for %v", names)
+	}
+}
@@ -2,17 +2,21 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/csv"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/graduate-work-mirea/data-processor-service/internal/featurespec"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
@@ -47,6 +51,15 @@ func NewPostgresRepository(connString string, logger *zap.SugaredLogger) (*Postg
 	return repo, nil
 }
 
+// EnsureSchema creates the schema of a pipeline's tables
+func (r *PostgresRepository) EnsureSchema(schema string) error {
+	_, err := r.pool.Exec(context.Background(), "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{schema}.Sanitize())
+	if err != nil {
+		return fmt.Errorf("failed to create schema %s: %v", schema, err)
+	}
+	return nil
+}
+
 // RunMigrations runs database migrations
 func (r *PostgresRepository) RunMigrations(dbName string) error {
 	// Extract connection details from pgx pool to create a sql.DB connection
@@ -64,6 +77,10 @@ func (r *PostgresRepository) RunMigrations(dbName string) error {
 		config.ConnConfig.Database,
 		"disable", // Use your desired SSL mode
 	)
+	// Keep the pipeline's schema, so its migrations and migration history live there
+	if searchPath := config.ConnConfig.RuntimeParams["search_path"]; searchPath != "" {
+		sqlConnStr += "&search_path=" + url.QueryEscape(searchPath)
+	}
 
 	// Open a database connection specifically for migrations
 	db, err := sql.Open("postgres", sqlConnStr)
@@ -104,82 +121,212 @@ func (r *PostgresRepository) Close() {
 	}
 }
 
-// SaveProcessedData saves processed data to the database
-func (r *PostgresRepository) SaveProcessedData(filePath string, dataType string) error {
+// processedDataColumn describes how a CSV column is loaded into processed_data
+type processedDataColumn struct {
+	name  string
+	parse func(row []string, colIndices map[string]int, colName string) interface{}
+}
+
+// baseProcessedDataColumns are the processed_data columns that do not depend on the feature spec
+var baseProcessedDataColumns = []processedDataColumn{
+	{"product_id", parseString},
+	{"product_name", parseString},
+	{"date", parseString},
+	{"region", parseString},
+	{"brand", parseString},
+	{"category", parseString},
+	{"sales_quantity", parseRequiredDecimal},
+	{"price", parseRequiredDecimal},
+	{"original_price", parseRequiredDecimal},
+	{"discount_percentage", parseRequiredDecimal},
+	{"stock_level", parseRequiredDecimal},
+	{"customer_rating", parseRequiredDecimal},
+	{"review_count", parseRequiredDecimal},
+	{"delivery_days", parseRequiredDecimal},
+	{"seller", parseString},
+	{"is_weekend", parseBool},
+	{"is_holiday", parseBool},
+	{"day_of_week", parseRequiredInt},
+	{"month", parseRequiredInt},
+	{"quarter", parseRequiredInt},
+	{"is_imputed", parseBool},
+	// Holiday calendar features
+	{"days_to_next_holiday", parseNullableInt},
+	{"days_since_last_holiday", parseNullableInt},
+	// Currency audit fields: prices before conversion to the base currency
+	{"currency", parseNullableString},
+	{"exchange_rate", parseNullableDecimal},
+	{"price_local", parseNullableDecimal},
+	{"original_price_local", parseNullableDecimal},
+	// Cross-validation fold whose test window contains the row
+	{"fold_id", parseFoldID},
+}
+
+// closeProcessedDataVersion closes the current version of a row whose content has changed.
+// The data type is part of the content, so a row that moves to another split is closed too.
+const closeProcessedDataVersion = `
+	UPDATE processed_data SET valid_to = $4
+	WHERE product_id = $1 AND date = $2 AND region = $3
+		AND valid_to IS NULL AND row_hash IS DISTINCT FROM $5
+`
+
+// createProcessedRunKeys creates the table of the keys loaded by a run, dropped when the load commits
+const createProcessedRunKeys = `
+	CREATE TEMP TABLE processed_run_keys ON COMMIT DROP AS
+	SELECT product_id, date, region FROM processed_data WITH NO DATA
+`
+
+// insertProcessedRunKey records a key loaded by the run
+const insertProcessedRunKey = `INSERT INTO processed_run_keys (product_id, date, region) VALUES ($1, $2, $3)`
+
+// closeMissingProcessedData closes the current versions of rows that the run no longer produces:
+// rows of the run's series within the dates the run covers whose key was not loaded
+const closeMissingProcessedData = `
+	UPDATE processed_data p SET valid_to = $1
+	FROM (
+		SELECT product_id, region, MIN(date) AS first_date, MAX(date) AS last_date
+		FROM processed_run_keys
+		GROUP BY product_id, region
+	) s
+	WHERE p.valid_to IS NULL AND p.product_id = s.product_id AND p.region = s.region
+		AND p.date BETWEEN s.first_date AND s.last_date
+		AND NOT EXISTS (
+			SELECT 1 FROM processed_run_keys k
+			WHERE k.product_id = p.product_id AND k.date = p.date AND k.region = p.region
+		)
+`
+
+// EnsureFeatureColumns adds the columns generated from the feature spec to processed_data
+func (r *PostgresRepository) EnsureFeatureColumns(columns []string) error {
+	for _, col := range columns {
+		sql := fmt.Sprintf("ALTER TABLE processed_data ADD COLUMN IF NOT EXISTS %s DECIMAL", pgx.Identifier{col}.Sanitize())
+		if _, err := r.pool.Exec(context.Background(), sql); err != nil {
+			return fmt.Errorf("failed to add column %s: %v", col, err)
+		}
+	}
+
+	r.logger.Infof("Ensured %d feature columns in processed_data", len(columns))
+	return nil
+}
+
+// buildProcessedDataInsert builds the statement inserting a new version of a processed row.
+// An unchanged row keeps its current version, so nothing is inserted.
+func buildProcessedDataInsert(columns []string) string {
+	names := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = pgx.Identifier{col}.Sanitize()
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	return fmt.Sprintf(`
+		INSERT INTO processed_data (%s)
+		VALUES (%s)
+		ON CONFLICT (product_id, date, region) WHERE valid_to IS NULL DO NOTHING
+	`, strings.Join(names, ", "), strings.Join(placeholders, ", "))
+}
+
+// processedRowHash returns the hash of the content of a processed row
+func processedRowHash(values []interface{}) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprint(values...))))
+}
+
+// ProcessedFile is a processed split file of a run
+type ProcessedFile struct {
+	DataType string
+	Path     string
+}
+
+// SaveProcessedData saves the processed split files of a run to the database in one transaction.
+// Feature columns of the spec are stored as columns, targets in the targets JSONB map
+// and categorical encodings in the encoded JSONB map. Rows are versioned per (product_id, date, region):
+// a changed row closes its current version and is stored as a new one valid from the load time,
+// and rows of the run's series that the run no longer produces are closed.
+func (r *PostgresRepository) SaveProcessedData(files []ProcessedFile, spec *featurespec.Spec, runID string) error {
+	loadedAt := time.Now()
+
+	// Start a transaction
+	tx, err := r.pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(context.Background(), createProcessedRunKeys); err != nil {
+		return fmt.Errorf("failed to create run keys table: %v", err)
+	}
+
+	for _, file := range files {
+		count, err := r.saveProcessedFile(tx, file, spec, runID, loadedAt)
+		if err != nil {
+			return err
+		}
+		r.logger.Infof("Saved %d rows of %s data", count, file.DataType)
+	}
+
+	tag, err := tx.Exec(context.Background(), closeMissingProcessedData, loadedAt)
+	if err != nil {
+		return fmt.Errorf("failed to close missing processed rows: %v", err)
+	}
+	if tag.RowsAffected() > 0 {
+		r.logger.Infof("Closed %d processed rows no longer produced by run %s", tag.RowsAffected(), runID)
+	}
+
+	// Commit transaction
+	if err = tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	r.logger.Infof("Successfully saved processed data of run %s to the database", runID)
+	return nil
+}
+
+// saveProcessedFile loads one split file in the run's transaction and returns its row count
+func (r *PostgresRepository) saveProcessedFile(tx pgx.Tx, file ProcessedFile, spec *featurespec.Spec, runID string, loadedAt time.Time) (int, error) {
+	featureColumns := spec.FeatureColumns()
+	targetColumns := spec.TargetColumns()
+
 	// Open the CSV file
-	file, err := os.Open(filePath)
+	f, err := os.Open(file.Path)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %v", filePath, err)
+		return 0, fmt.Errorf("failed to open file %s: %v", file.Path, err)
 	}
-	defer file.Close()
+	defer f.Close()
 
 	// Create a CSV reader
-	reader := csv.NewReader(file)
+	reader := csv.NewReader(f)
 
 	// Read header
 	header, err := reader.Read()
 	if err != nil {
-		return fmt.Errorf("failed to read header: %v", err)
+		return 0, fmt.Errorf("failed to read header: %v", err)
 	}
 
 	// Create a map of column indices
 	colIndices := make(map[string]int)
+	var encodedColumns []string
 	for i, colName := range header {
 		colIndices[colName] = i
+		if spec.IsEncodedColumn(colName) {
+			encodedColumns = append(encodedColumns, colName)
+		}
 	}
 
-	// Prepare SQL statement
-	sql := `
-		INSERT INTO processed_data (
-			product_name, date, region, brand, category, 
-			sales_quantity, price, original_price, discount_percentage, 
-			stock_level, customer_rating, review_count, delivery_days, 
-			seller, is_weekend, is_holiday, day_of_week, month, quarter,
-			sales_quantity_lag_1, sales_quantity_lag_3, sales_quantity_lag_7, 
-			price_lag_1, price_lag_3, price_lag_7, 
-			sales_quantity_rolling_mean_3, sales_quantity_rolling_mean_7,
-			price_rolling_mean_3, price_rolling_mean_7,
-			price_target, sales_target, data_type
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, 
-			$17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32
-		) ON CONFLICT (product_name, date, region, data_type) DO UPDATE SET
-			brand = EXCLUDED.brand,
-			category = EXCLUDED.category,
-			sales_quantity = EXCLUDED.sales_quantity,
-			price = EXCLUDED.price,
-			original_price = EXCLUDED.original_price,
-			discount_percentage = EXCLUDED.discount_percentage,
-			stock_level = EXCLUDED.stock_level,
-			customer_rating = EXCLUDED.customer_rating,
-			review_count = EXCLUDED.review_count,
-			delivery_days = EXCLUDED.delivery_days,
-			seller = EXCLUDED.seller,
-			is_weekend = EXCLUDED.is_weekend,
-			is_holiday = EXCLUDED.is_holiday,
-			day_of_week = EXCLUDED.day_of_week,
-			month = EXCLUDED.month,
-			quarter = EXCLUDED.quarter,
-			sales_quantity_lag_1 = EXCLUDED.sales_quantity_lag_1,
-			sales_quantity_lag_3 = EXCLUDED.sales_quantity_lag_3,
-			sales_quantity_lag_7 = EXCLUDED.sales_quantity_lag_7,
-			price_lag_1 = EXCLUDED.price_lag_1,
-			price_lag_3 = EXCLUDED.price_lag_3,
-			price_lag_7 = EXCLUDED.price_lag_7,
-			sales_quantity_rolling_mean_3 = EXCLUDED.sales_quantity_rolling_mean_3,
-			sales_quantity_rolling_mean_7 = EXCLUDED.sales_quantity_rolling_mean_7,
-			price_rolling_mean_3 = EXCLUDED.price_rolling_mean_3,
-			price_rolling_mean_7 = EXCLUDED.price_rolling_mean_7,
-			price_target = EXCLUDED.price_target,
-			sales_target = EXCLUDED.sales_target
-	`
+	// The output schema must contain every column declared in the feature spec
+	for _, col := range append(append([]string(nil), featureColumns...), targetColumns...) {
+		if _, ok := colIndices[col]; !ok {
+			return 0, fmt.Errorf("column %s declared in the feature spec is missing from %s", col, file.Path)
+		}
+	}
 
-	// Start a transaction
-	tx, err := r.pool.Begin(context.Background())
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+	// Prepare SQL statement
+	columns := make([]string, 0, len(baseProcessedDataColumns)+len(featureColumns)+1)
+	for _, col := range baseProcessedDataColumns {
+		columns = append(columns, col.name)
 	}
-	defer tx.Rollback(context.Background())
+	columns = append(columns, featureColumns...)
+	columns = append(columns, "targets", "encoded", "data_type", "run_id", "row_hash", "valid_from")
+	sql := buildProcessedDataInsert(columns)
 
 	// Use a batch for more efficient inserts
 	batch := &pgx.Batch{}
@@ -192,64 +339,44 @@ func (r *PostgresRepository) SaveProcessedData(filePath string, dataType string)
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("error reading row: %v", err)
+			return 0, fmt.Errorf("error reading row: %v", err)
 		}
 
 		// Extract and convert values (handling nulls as needed)
-		var params []interface{}
-		params = append(params, row[colIndices["product_name"]])                      // product_name
-		params = append(params, row[colIndices["date"]])                              // date
-		params = append(params, row[colIndices["region"]])                            // region
-		params = append(params, row[colIndices["brand"]])                             // brand
-		params = append(params, row[colIndices["category"]])                          // category
-		params = append(params, parseDecimal(row[colIndices["sales_quantity"]]))      // sales_quantity
-		params = append(params, parseDecimal(row[colIndices["price"]]))               // price
-		params = append(params, parseDecimal(row[colIndices["original_price"]]))      // original_price
-		params = append(params, parseDecimal(row[colIndices["discount_percentage"]])) // discount_percentage
-		params = append(params, parseDecimal(row[colIndices["stock_level"]]))         // stock_level
-		params = append(params, parseDecimal(row[colIndices["customer_rating"]]))     // customer_rating
-		params = append(params, parseDecimal(row[colIndices["review_count"]]))        // review_count
-		params = append(params, parseDecimal(row[colIndices["delivery_days"]]))       // delivery_days
-		params = append(params, row[colIndices["seller"]])                            // seller
-		params = append(params, row[colIndices["is_weekend"]] == "True")              // is_weekend
-		params = append(params, row[colIndices["is_holiday"]] == "True")              // is_holiday
-		params = append(params, parseInt(row[colIndices["day_of_week"]]))             // day_of_week
-		params = append(params, parseInt(row[colIndices["month"]]))                   // month
-		params = append(params, parseInt(row[colIndices["quarter"]]))                 // quarter
-
-		// Optional fields with lag data
-		params = append(params, parseNullableDecimal(row, colIndices, "sales_quantity_lag_1"))
-		params = append(params, parseNullableDecimal(row, colIndices, "sales_quantity_lag_3"))
-		params = append(params, parseNullableDecimal(row, colIndices, "sales_quantity_lag_7"))
-		params = append(params, parseNullableDecimal(row, colIndices, "price_lag_1"))
-		params = append(params, parseNullableDecimal(row, colIndices, "price_lag_3"))
-		params = append(params, parseNullableDecimal(row, colIndices, "price_lag_7"))
-
-		// Optional fields with rolling means
-		params = append(params, parseNullableDecimal(row, colIndices, "sales_quantity_rolling_mean_3"))
-		params = append(params, parseNullableDecimal(row, colIndices, "sales_quantity_rolling_mean_7"))
-		params = append(params, parseNullableDecimal(row, colIndices, "price_rolling_mean_3"))
-		params = append(params, parseNullableDecimal(row, colIndices, "price_rolling_mean_7"))
-
-		// Target fields
-		params = append(params, parseDecimal(row[colIndices["price_target"]])) // price_target
-		params = append(params, parseDecimal(row[colIndices["sales_target"]])) // sales_target
-		params = append(params, dataType)                                      // data_type
-
-		// Add query to batch
+		params := make([]interface{}, 0, len(columns))
+		for _, col := range baseProcessedDataColumns {
+			params = append(params, col.parse(row, colIndices, col.name))
+		}
+		for _, col := range featureColumns {
+			params = append(params, parseNullableDecimal(row, colIndices, col))
+		}
+		params = append(params, parseValueMap(row, colIndices, targetColumns))  // targets
+		params = append(params, parseValueMap(row, colIndices, encodedColumns)) // encoded
+		params = append(params, file.DataType)                                  // data_type
+
+		// The run id is not part of the content, rerunning on the same data keeps the version
+		rowHash := processedRowHash(params)
+		params = append(params, runID, rowHash, loadedAt) // run_id, row_hash, valid_from
+
+		// Close the current version if the row changed, then insert the new version
+		productID := parseString(row, colIndices, "product_id")
+		date := parseString(row, colIndices, "date")
+		region := parseString(row, colIndices, "region")
+		batch.Queue(closeProcessedDataVersion, productID, date, region, loadedAt, rowHash)
 		batch.Queue(sql, params...)
+		batch.Queue(insertProcessedRunKey, productID, date, region)
 		count++
 
 		// Execute batch every 1000 rows
 		if count%1000 == 0 {
-			br := r.pool.SendBatch(context.Background(), batch)
+			br := tx.SendBatch(context.Background(), batch)
 			_, err = br.Exec()
 			if err != nil {
-				return fmt.Errorf("error executing batch: %v", err)
+				return 0, fmt.Errorf("error executing batch: %v", err)
 			}
 			err = br.Close()
 			if err != nil {
-				return fmt.Errorf("error closing batch results: %v", err)
+				return 0, fmt.Errorf("error closing batch results: %v", err)
 			}
 			batch = &pgx.Batch{}
 			r.logger.Infof("Inserted %d rows", count)
@@ -258,24 +385,18 @@ func (r *PostgresRepository) SaveProcessedData(filePath string, dataType string)
 
 	// Execute any remaining batch items
 	if count%1000 != 0 {
-		br := r.pool.SendBatch(context.Background(), batch)
+		br := tx.SendBatch(context.Background(), batch)
 		_, err = br.Exec()
 		if err != nil {
-			return fmt.Errorf("error executing final batch: %v", err)
+			return 0, fmt.Errorf("error executing final batch: %v", err)
 		}
 		err = br.Close()
 		if err != nil {
-			return fmt.Errorf("error closing final batch results: %v", err)
+			return 0, fmt.Errorf("error closing final batch results: %v", err)
 		}
 	}
 
-	// Commit transaction
-	if err = tx.Commit(context.Background()); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
-	}
-
-	r.logger.Infof("Successfully saved %d rows of %s data to the database", count, dataType)
-	return nil
+	return count, nil
 }
 
 // Helper functions for type conversion
@@ -291,6 +412,30 @@ func parseDecimal(val string) float64 {
 	return f
 }
 
+func parseRequiredDecimal(row []string, colIndices map[string]int, colName string) interface{} {
+	idx, exists := colIndices[colName]
+	if !exists || idx >= len(row) {
+		return float64(0)
+	}
+	return parseDecimal(row[idx])
+}
+
+func parseRequiredInt(row []string, colIndices map[string]int, colName string) interface{} {
+	idx, exists := colIndices[colName]
+	if !exists || idx >= len(row) {
+		return 0
+	}
+	return parseInt(row[idx])
+}
+
+func parseString(row []string, colIndices map[string]int, colName string) interface{} {
+	idx, exists := colIndices[colName]
+	if !exists || idx >= len(row) {
+		return ""
+	}
+	return row[idx]
+}
+
 func parseNullableDecimal(row []string, colIndices map[string]int, colName string) interface{} {
 	idx, exists := colIndices[colName]
 	if !exists || idx >= len(row) {
@@ -307,6 +452,52 @@ func parseNullableDecimal(row []string, colIndices map[string]int, colName strin
 	return f
 }
 
+func parseNullableString(row []string, colIndices map[string]int, colName string) interface{} {
+	idx, exists := colIndices[colName]
+	if !exists || idx >= len(row) {
+		return nil
+	}
+	val := strings.TrimSpace(row[idx])
+	if val == "" {
+		return nil
+	}
+	return val
+}
+
+func parseBool(row []string, colIndices map[string]int, colName string) interface{} {
+	idx, exists := colIndices[colName]
+	if !exists || idx >= len(row) {
+		return false
+	}
+	return strings.TrimSpace(row[idx]) == "True"
+}
+
+func parseNullableInt(row []string, colIndices map[string]int, colName string) interface{} {
+	f, ok := parseNullableDecimal(row, colIndices, colName).(float64)
+	if !ok {
+		return nil
+	}
+	return int(f)
+}
+
+func parseFoldID(row []string, colIndices map[string]int, colName string) interface{} {
+	if fold, ok := parseNullableInt(row, colIndices, colName).(int); ok {
+		return fold
+	}
+	return -1
+}
+
+// parseValueMap collects the non-null numeric values of the given columns into a map stored as JSONB
+func parseValueMap(row []string, colIndices map[string]int, columns []string) map[string]float64 {
+	values := make(map[string]float64, len(columns))
+	for _, col := range columns {
+		if val, ok := parseNullableDecimal(row, colIndices, col).(float64); ok {
+			values[col] = val
+		}
+	}
+	return values
+}
+
 func parseInt(val string) int {
 	if val == "" {
 		return 0
@@ -317,3 +508,55 @@ func parseInt(val string) int {
 	}
 	return i
 }
+
+// SaveExchangeRates upserts daily exchange rates into the exchange_rates table
+func (r *PostgresRepository) SaveExchangeRates(rates []ExchangeRate, baseCurrency string) error {
+	sql := `
+		INSERT INTO exchange_rates (date, currency, base_currency, rate)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (date, currency, base_currency) DO UPDATE SET
+			rate = EXCLUDED.rate,
+			updated_at = CURRENT_TIMESTAMP
+	`
+
+	batch := &pgx.Batch{}
+	for _, rate := range rates {
+		batch.Queue(sql, rate.Date, rate.Currency, baseCurrency, rate.Rate)
+	}
+
+	br := r.pool.SendBatch(context.Background(), batch)
+	defer br.Close()
+	for range rates {
+		if _, err := br.Exec(); err != nil {
+			return fmt.Errorf("error saving exchange rate: %v", err)
+		}
+	}
+
+	r.logger.Infof("Saved %d exchange rates to the database", len(rates))
+	return nil
+}
+
+// GetExchangeRates returns all stored exchange rates for the base currency
+func (r *PostgresRepository) GetExchangeRates(baseCurrency string) ([]ExchangeRate, error) {
+	rows, err := r.pool.Query(context.Background(), `
+		SELECT to_char(date, 'YYYY-MM-DD'), currency, rate::float8
+		FROM exchange_rates
+		WHERE base_currency = $1
+		ORDER BY date, currency
+	`, baseCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exchange rates: %v", err)
+	}
+	defer rows.Close()
+
+	var rates []ExchangeRate
+	for rows.Next() {
+		var rate ExchangeRate
+		if err := rows.Scan(&rate.Date, &rate.Currency, &rate.Rate); err != nil {
+			return nil, fmt.Errorf("failed to scan exchange rate: %v", err)
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Scaler holds the parameters of a fitted scaler: scaled = (value - Center) / Scale
+type Scaler struct {
+	Method string              `json:"method"`
+	Center float64             `json:"center"`
+	Scale  float64             `json:"scale"`
+	Stats  map[string]*float64 `json:"stats"`
+}
+
+// ScalerParams are the scalers fitted during one run
+type ScalerParams struct {
+	RunID       string            `json:"run_id"`
+	SpecVersion int               `json:"spec_version"`
+	CreatedAt   string            `json:"created_at"`
+	Scalers     map[string]Scaler `json:"scalers"`
+}
+
+// SaveScalerParams stores the fitted scalers of a run
+func (r *PostgresRepository) SaveScalerParams(params *ScalerParams) error {
+	batch := &pgx.Batch{}
+	for column, scaler := range params.Scalers {
+		stats, err := json.Marshal(scaler.Stats)
+		if err != nil {
+			return fmt.Errorf("failed to encode stats of column %s: %v", column, err)
+		}
+
+		batch.Queue(`
+			INSERT INTO scaler_params (run_id, column_name, method, center, scale, stats, spec_version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (run_id, column_name) DO UPDATE SET
+				method = EXCLUDED.method,
+				center = EXCLUDED.center,
+				scale = EXCLUDED.scale,
+				stats = EXCLUDED.stats,
+				spec_version = EXCLUDED.spec_version
+		`, params.RunID, column, scaler.Method, scaler.Center, scaler.Scale, string(stats), params.SpecVersion)
+	}
+
+	if err := r.pool.SendBatch(context.Background(), batch).Close(); err != nil {
+		return fmt.Errorf("error saving scaler params: %v", err)
+	}
+
+	r.logger.Infof("Saved %d scalers of run %s to the database", len(params.Scalers), params.RunID)
+	return nil
+}
+
+// GetScalerParams returns the scalers of a run, or of the latest run when runID is empty.
+// It returns nil when no scalers are stored for the run.
+func (r *PostgresRepository) GetScalerParams(runID string) (*ScalerParams, error) {
+	if runID == "" {
+		err := r.pool.QueryRow(context.Background(),
+			`SELECT run_id FROM scaler_params ORDER BY created_at DESC, run_id DESC LIMIT 1`,
+		).Scan(&runID)
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query latest scaling run: %v", err)
+		}
+	}
+
+	rows, err := r.pool.Query(context.Background(), `
+		SELECT column_name, method, center, scale, stats::text, spec_version,
+			to_char(created_at, 'YYYY-MM-DD"T"HH24:MI:SS')
+		FROM scaler_params
+		WHERE run_id = $1
+	`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scaler params: %v", err)
+	}
+	defer rows.Close()
+
+	params := &ScalerParams{RunID: runID, Scalers: make(map[string]Scaler)}
+	for rows.Next() {
+		var column, stats string
+		var scaler Scaler
+		if err := rows.Scan(&column, &scaler.Method, &scaler.Center, &scaler.Scale, &stats,
+			&params.SpecVersion, &params.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan scaler params: %v", err)
+		}
+		if err := json.Unmarshal([]byte(stats), &scaler.Stats); err != nil {
+			return nil, fmt.Errorf("failed to parse stats of column %s: %v", column, err)
+		}
+		params.Scalers[column] = scaler
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(params.Scalers) == 0 {
+		return nil, nil
+	}
+	return params, nil
+}
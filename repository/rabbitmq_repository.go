@@ -3,18 +3,59 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/graduate-work-mirea/data-processor-service/internal/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
 )
 
+// ConsumedBatch holds consumed messages. Their deliveries stay unacknowledged until the
+// batch is settled, so messages of a failed or interrupted run are redelivered.
+type ConsumedBatch struct {
+	Data       []map[string]interface{}
+	deliveries []amqp.Delivery
+	repo       *RabbitMQRepository
+	logger     *zap.SugaredLogger
+}
+
+// Ack acknowledges all messages of the batch
+func (b *ConsumedBatch) Ack() {
+	for _, d := range b.deliveries {
+		if err := d.Ack(false); err != nil {
+			b.logger.Warnf("Failed to acknowledge message: %v", err)
+		}
+	}
+	b.logger.Infof("Acknowledged %d messages", len(b.deliveries))
+	b.deliveries = nil
+}
+
+// Nack returns all messages of the batch to the queue
+func (b *ConsumedBatch) Nack() {
+	for _, d := range b.deliveries {
+		if err := d.Nack(false, true); err != nil {
+			b.logger.Warnf("Failed to requeue message: %v", err)
+			continue
+		}
+		b.repo.noteRequeued(d)
+	}
+	b.logger.Infof("Requeued %d unprocessed messages", len(b.deliveries))
+	b.deliveries = nil
+}
+
 // RabbitMQRepository handles RabbitMQ operations
 type RabbitMQRepository struct {
 	client    *rabbitmq.Client
 	queueName string
 	logger    *zap.SugaredLogger
+
+	// requeuedSince is the earliest publish time of the messages this consumer returned
+	// to the head of the queue, zero when none with a timestamp is waiting
+	mu            sync.Mutex
+	requeuedSince time.Time
 }
 
 // NewRabbitMQRepository creates a new RabbitMQRepository instance
@@ -26,10 +67,16 @@ func NewRabbitMQRepository(client *rabbitmq.Client, queueName string, logger *za
 	}
 }
 
-// ConsumeMessages consumes messages from the RabbitMQ queue
-func (r *RabbitMQRepository) ConsumeMessages(ctx context.Context, batchSize int, timeout time.Duration) ([]map[string]interface{}, error) {
+// ConsumeMessages consumes a batch of messages from the RabbitMQ queue.
+// The caller settles the returned batch with Ack or Nack once it has been processed.
+func (r *RabbitMQRepository) ConsumeMessages(ctx context.Context, batchSize int, timeout time.Duration) (*ConsumedBatch, error) {
 	r.logger.Infof("Starting to consume messages from queue: %s", r.queueName)
 
+	// The batch is read from the head of the queue, messages returned to it are noted again
+	r.mu.Lock()
+	r.requeuedSince = time.Time{}
+	r.mu.Unlock()
+
 	// Declare queue
 	q, err := r.client.DeclareQueue(r.queueName)
 	if err != nil {
@@ -47,20 +94,21 @@ func (r *RabbitMQRepository) ConsumeMessages(ctx context.Context, batchSize int,
 	}
 
 	// Consume messages
+	consumerTag := fmt.Sprintf("data-processor-%d", time.Now().UnixNano())
 	msgs, err := r.client.Channel().Consume(
-		q.Name, // queue
-		"",     // consumer
-		false,  // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
+		q.Name,      // queue
+		consumerTag, // consumer
+		false,       // auto-ack
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to register consumer: %w", err)
 	}
 
-	var data []map[string]interface{}
+	batch := &ConsumedBatch{repo: r, logger: r.logger}
 	count := 0
 	timeoutCh := time.After(timeout)
 
@@ -68,14 +116,16 @@ func (r *RabbitMQRepository) ConsumeMessages(ctx context.Context, batchSize int,
 		select {
 		case <-ctx.Done():
 			r.logger.Info("Context cancelled, stopping message consumption")
-			return data, nil
+			r.cancelConsumer(consumerTag, msgs)
+			return batch, nil
 		case <-timeoutCh:
 			r.logger.Infof("Timeout reached after consuming %d messages", count)
-			return data, nil
+			r.cancelConsumer(consumerTag, msgs)
+			return batch, nil
 		case msg, ok := <-msgs:
 			if !ok {
 				r.logger.Info("Channel closed, stopping message consumption")
-				return data, nil
+				return batch, nil
 			}
 
 			// Parse message
@@ -86,36 +136,106 @@ func (r *RabbitMQRepository) ConsumeMessages(ctx context.Context, batchSize int,
 				continue
 			}
 
-			// Add to batch
-			data = append(data, item)
+			// Add to batch, the message is acknowledged once the batch is processed
+			batch.Data = append(batch.Data, item)
+			batch.deliveries = append(batch.deliveries, msg)
 			count++
 
-			// Acknowledge message
-			if err := msg.Ack(false); err != nil {
-				r.logger.Warnf("Failed to acknowledge message: %v", err)
-			}
-
 			// Check if we've reached the batch size
 			if count >= batchSize {
 				r.logger.Infof("Batch size reached, consumed %d messages", count)
-				return data, nil
+				r.cancelConsumer(consumerTag, msgs)
+				return batch, nil
 			}
 		}
 	}
 }
 
-// PublishProcessedData publishes processed data to a queue
-func (r *RabbitMQRepository) PublishProcessedData(ctx context.Context, queueName string, data interface{}) error {
-	// Marshal data to JSON
-	jsonData, err := json.Marshal(data)
+// cancelConsumer stops the consumer and returns messages prefetched but not read to the queue
+func (r *RabbitMQRepository) cancelConsumer(consumerTag string, msgs <-chan amqp.Delivery) {
+	if err := r.client.Channel().Cancel(consumerTag, false); err != nil {
+		r.logger.Warnf("Failed to cancel consumer: %v", err)
+		return
+	}
+
+	// The deliveries channel is closed once the cancellation is confirmed
+	for msg := range msgs {
+		if err := msg.Nack(false, true); err != nil {
+			r.logger.Warnf("Failed to requeue prefetched message: %v", err)
+			continue
+		}
+		r.noteRequeued(msg)
+	}
+}
+
+// noteRequeued records the publish time of a message returned to the queue
+func (r *RabbitMQRepository) noteRequeued(msg amqp.Delivery) {
+	if msg.Timestamp.IsZero() {
+		return
+	}
+	r.mu.Lock()
+	if r.requeuedSince.IsZero() || msg.Timestamp.Before(r.requeuedSince) {
+		r.requeuedSince = msg.Timestamp
+	}
+	r.mu.Unlock()
+}
+
+// QueueDepth returns the number of messages ready in the queue, a queue that does not exist yet is empty
+func (r *RabbitMQRepository) QueueDepth() (int, error) {
+	q, err := r.client.InspectQueue(r.queueName)
+	if err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to inspect queue: %w", err)
+	}
+	return q.Messages, nil
+}
+
+// OldestMessageTime returns the publish time of the oldest waiting message as far as the consumer knows it:
+// the earliest timestamp of the messages it returned to the queue. Messages are not read to find out,
+// so the zero time is returned for messages the consumer has not seen and for a missing or empty queue.
+func (r *RabbitMQRepository) OldestMessageTime() (time.Time, error) {
+	depth, err := r.QueueDepth()
 	if err != nil {
-		return fmt.Errorf("failed to marshal data: %w", err)
+		return time.Time{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if depth == 0 {
+		// Another consumer may have taken the returned messages
+		r.requeuedSince = time.Time{}
+	}
+	return r.requeuedSince, nil
+}
+
+// PublishEvent publishes a JSON event and waits for the broker's confirm. With the default
+// exchange the routing key is the queue name, and the queue is declared so the event is routable.
+func (r *RabbitMQRepository) PublishEvent(ctx context.Context, exchange, routingKey, eventType, eventID string, event interface{}) error {
+	// Marshal event to JSON
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if exchange == "" {
+		if _, err := r.client.DeclareQueue(routingKey); err != nil {
+			return fmt.Errorf("failed to declare queue: %w", err)
+		}
 	}
 
-	// Publish message
-	err = r.client.PublishMessage(ctx, queueName, jsonData)
+	// Publish event
+	err = r.client.PublishConfirmed(ctx, exchange, routingKey, amqp.Publishing{
+		ContentType: "application/json",
+		Type:        eventType,
+		MessageId:   eventID,
+		Timestamp:   time.Now(),
+		Body:        jsonData,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to publish message: %w", err)
+		return fmt.Errorf("failed to publish event: %w", err)
 	}
 
 	return nil
@@ -1,10 +1,14 @@
 import pandas as pd
+import numpy as np
 import json
 import os
 import sys
 import logging
 from datetime import datetime, timedelta
 import argparse
+import hashlib
+import html
+import shutil
 
 # Настройка логирования
 logging.basicConfig(
@@ -21,6 +25,76 @@ def load_data(input_file):
         data = json.load(f)
     return pd.DataFrame(data)
 
+# Ключ ряда по умолчанию: признаки и цели считаются по продукту и региону
+DEFAULT_SERIES_KEY = ['product_id', 'region']
+
+# Колонки, по которым preprocess_data агрегирует записи одной даты
+RECORD_KEY = ['product_id', 'region', 'brand', 'category']
+
+# Значение region у рядов, объединяющих все регионы
+ALL_REGIONS_LABEL = '__all__'
+
+# Агрегация записей одного продукта за одну дату
+RECORD_AGGREGATIONS = {
+    'product_name': 'first',
+    'sales_quantity': 'sum',
+    'price': 'mean',
+    'original_price': 'mean',
+    'discount_percentage': 'mean',
+    'stock_level': 'mean',
+    'customer_rating': 'mean',
+    'review_count': 'mean',
+    'delivery_days': 'mean',
+    'seller': 'first',
+    'is_weekend': 'first',
+    'is_holiday': 'first',
+    'currency': 'first',
+    'exchange_rate': 'mean',
+    'price_local': 'mean',
+    'original_price_local': 'mean'
+}
+
+def load_exchange_rates(path):
+    """Загрузка дневных курсов валют (стоимость единицы валюты в базовой валюте)."""
+    if not path:
+        return pd.DataFrame({'date': pd.to_datetime([]), 'currency': [], 'rate': []})
+    logger.info(f"Loading exchange rates from {path}")
+    rates = pd.read_csv(path)
+    rates['date'] = pd.to_datetime(rates['date'])
+    rates['currency'] = rates['currency'].astype(str).str.strip().str.upper()
+    return rates.dropna(subset=['rate'])
+
+def convert_currencies(df, rates, base_currency):
+    """Пересчёт цен в базовую валюту с сохранением исходных значений для аудита."""
+    logger.info(f"Converting prices to {base_currency}")
+
+    if 'currency' not in df.columns:
+        df['currency'] = base_currency
+    df['currency'] = df['currency'].fillna(base_currency).astype(str).str.strip().str.upper()
+    df['date'] = pd.to_datetime(df['date'])
+
+    for field in ('price', 'original_price'):
+        df[field] = pd.to_numeric(df[field], errors='coerce')
+        df[f'{field}_local'] = df[field]
+
+    # Курс на дату записи или последний известный до неё
+    df['exchange_rate'] = np.where(df['currency'] == base_currency, 1.0, np.nan)
+    foreign = df['currency'] != base_currency
+    if foreign.any() and not rates.empty:
+        lookup = df.loc[foreign, ['date', 'currency']].reset_index().sort_values('date')
+        matched = pd.merge_asof(lookup, rates.sort_values('date'), on='date', by='currency', direction='backward')
+        df.loc[matched['index'], 'exchange_rate'] = matched['rate'].values
+
+    missing = df['exchange_rate'].isna()
+    if missing.any():
+        currencies = sorted(df.loc[missing, 'currency'].unique())
+        logger.warning(f"Dropping {int(missing.sum())} rows without an exchange rate for currencies {currencies}")
+        df = df[~missing].copy()
+
+    df['price'] = df['price'] * df['exchange_rate']
+    df['original_price'] = df['original_price'] * df['exchange_rate']
+    return df
+
 def preprocess_data(df):
     """Предобработка данных: обработка типов и пропущенных значений."""
     logger.info("Starting data preprocessing")
@@ -28,12 +102,18 @@ def preprocess_data(df):
     # Преобразование даты
     df['date'] = pd.to_datetime(df['date'])
 
+    # Идентификатор продукта назначается сервисом; без него ряды ключуются по названию
+    if 'product_id' not in df.columns:
+        logger.warning("Records have no product_id, falling back to product_name as the product key")
+        df['product_id'] = df['product_name']
+    df['product_id'] = df['product_id'].fillna(df['product_name'])
+
     # Числовые поля: интерполяция и заполнение пропусков
     numeric_fields = ['sales_quantity', 'price', 'original_price', 'discount_percentage',
                       'stock_level', 'customer_rating', 'review_count', 'delivery_days']
     for field in numeric_fields:
         df[field] = pd.to_numeric(df[field], errors='coerce')
-        df[field] = df.groupby('product_name')[field].transform(
+        df[field] = df.groupby('product_id')[field].transform(
             lambda x: x.interpolate().bfill().ffill()
         )
 
@@ -50,22 +130,259 @@ def preprocess_data(df):
         df[field] = df[field].fillna('unknown')
 
     # Агрегация данных
-    return df.groupby(['product_name', 'date', 'region', 'brand', 'category']).agg({
-        'sales_quantity': 'sum',
-        'price': 'mean',
-        'original_price': 'mean',
-        'discount_percentage': 'mean',
-        'stock_level': 'mean',
-        'customer_rating': 'mean',
-        'review_count': 'mean',
-        'delivery_days': 'mean',
-        'seller': 'first',
-        'is_weekend': 'first',
-        'is_holiday': 'first'
-    }).reset_index()
-
-def create_features(df):
-    """Создание признаков для модели."""
+    return df.groupby(['product_id', 'date', 'region', 'brand', 'category']).agg(RECORD_AGGREGATIONS).reset_index()
+
+def aggregate_series(df, series_key):
+    """Агрегация записей до одной строки на ряд и дату, если ключ ряда не включает все колонки RECORD_KEY."""
+    keys = list(series_key) + ['date']
+    missing = [col for col in RECORD_KEY if col not in keys]
+    if not missing:
+        return df
+    logger.info(f"Aggregating records to one row per series {list(series_key)} and date")
+
+    aggregations = {col: 'first' for col in missing if col != 'region'}
+    aggregations.update({col: agg for col, agg in RECORD_AGGREGATIONS.items() if col in df.columns and col not in keys})
+    combined = df.groupby(keys).agg(aggregations).reset_index()
+    # Ряд без региона в ключе объединяет все регионы продукта
+    if 'region' in missing:
+        combined['region'] = ALL_REGIONS_LABEL
+    logger.info(f"Aggregated {len(df)} rows into {len(combined)}")
+    return combined
+
+# Стратегии заполнения пропущенных дней по умолчанию
+DEFAULT_FILL_STRATEGIES = {
+    'sales_quantity': 'zero',
+    'price': 'ffill',
+    'original_price': 'ffill',
+    'discount_percentage': 'ffill',
+    'stock_level': 'interpolate',
+    'customer_rating': 'ffill',
+    'review_count': 'ffill',
+    'delivery_days': 'ffill',
+}
+FILL_METHODS = ('zero', 'ffill', 'interpolate')
+
+def parse_fill_strategies(spec):
+    """Разбор стратегий заполнения вида 'field=method,field=method'."""
+    strategies = dict(DEFAULT_FILL_STRATEGIES)
+    if not spec:
+        return strategies
+    for item in spec.split(','):
+        item = item.strip()
+        if not item:
+            continue
+        field, _, method = item.partition('=')
+        field, method = field.strip(), method.strip()
+        if method not in FILL_METHODS:
+            raise ValueError(f"Unknown fill method '{method}' for field '{field}', expected one of {FILL_METHODS}")
+        strategies[field] = method
+    return strategies
+
+def fill_calendar_gaps(df, fill_strategies, series_key=DEFAULT_SERIES_KEY):
+    """Переиндексация каждого ряда на непрерывный дневной календарь с заполнением пропусков."""
+    logger.info("Filling calendar gaps in product time series")
+    series_key = list(series_key)
+
+    df = df.sort_values(series_key + ['date'])
+    duplicates = df.duplicated(subset=series_key + ['date'], keep='last')
+    if duplicates.any():
+        logger.warning(f"Dropping {int(duplicates.sum())} duplicate rows before calendar reindexing")
+        df = df[~duplicates]
+
+    filled = []
+    for key, group in df.groupby(series_key, sort=False):
+        calendar = pd.date_range(group['date'].min(), group['date'].max(), freq='D')
+        group = group.set_index('date').reindex(calendar)
+        group.index.name = 'date'
+
+        # Синтетические строки помечаются флагом is_imputed
+        imputed = group[series_key[0]].isna()
+        group['is_imputed'] = imputed
+        for col, value in zip(series_key, key):
+            group[col] = value
+
+        for field, method in fill_strategies.items():
+            if field not in group.columns:
+                continue
+            if method == 'zero':
+                group[field] = group[field].fillna(0)
+            elif method == 'ffill':
+                group[field] = group[field].ffill()
+            elif method == 'interpolate':
+                group[field] = group[field].interpolate(method='linear').ffill()
+
+        # Категориальные и справочные поля переносятся с последнего наблюдения
+        for field in ['product_name', 'brand', 'category', 'seller', 'currency', 'exchange_rate']:
+            if field in group.columns and field not in series_key:
+                group[field] = group[field].ffill()
+
+        group['is_weekend'] = group['is_weekend'].where(~imputed, group.index.dayofweek >= 5)
+        group['is_holiday'] = group['is_holiday'].where(~imputed, False)
+        filled.append(group.reset_index())
+
+    if not filled:
+        return df.assign(is_imputed=False)
+
+    result = pd.concat(filled, ignore_index=True)
+    result['is_imputed'] = result['is_imputed'].astype(bool)
+    logger.info(f"Added {int(result['is_imputed'].sum())} imputed rows")
+    return result
+
+def add_cross_region_series(df, region_label):
+    """Добавление агрегированных по всем регионам рядов каждого продукта."""
+    logger.info(f"Creating cross-region aggregate series with region '{region_label}'")
+
+    aggregations = {'brand': 'first', 'category': 'first'}
+    aggregations.update({col: agg for col, agg in RECORD_AGGREGATIONS.items() if col in df.columns})
+    if 'is_imputed' in df.columns:
+        # Агрегированная строка синтетическая, только если синтетические все её составляющие
+        aggregations['is_imputed'] = 'all'
+
+    combined = df.groupby(['product_id', 'date']).agg(aggregations).reset_index()
+    combined['region'] = region_label
+    logger.info(f"Added {len(combined)} cross-region rows")
+    return pd.concat([df, combined], ignore_index=True)
+
+def load_calendar(path):
+    """Загрузка календаря праздников из JSON-файла."""
+    with open(path, 'r', encoding='utf-8') as f:
+        cal = json.load(f)
+    for field in ('name', 'version', 'holidays'):
+        if field not in cal:
+            raise ValueError(f"Holiday calendar {path} is missing required field '{field}'")
+    return {
+        'name': cal['name'],
+        'version': str(cal['version']),
+        'years': set(cal.get('years', [])),
+        'weekend_days': list(cal.get('weekend_days', [5, 6])),
+        'holidays': pd.DatetimeIndex(sorted(pd.to_datetime(list(cal['holidays'].keys())))),
+        'working_days': pd.DatetimeIndex(pd.to_datetime(cal.get('working_days', []))),
+    }
+
+def load_calendars(calendar_dir, calendar_files=()):
+    """Загрузка встроенных календарей и пользовательских файлов (последние переопределяют встроенные)."""
+    paths = []
+    if calendar_dir and os.path.isdir(calendar_dir):
+        paths += [os.path.join(calendar_dir, name) for name in sorted(os.listdir(calendar_dir)) if name.endswith('.json')]
+    paths += [path for path in calendar_files if path]
+
+    calendars = {}
+    for path in paths:
+        cal = load_calendar(path)
+        calendars[cal['name']] = cal
+        logger.info(f"Loaded holiday calendar '{cal['name']}' version {cal['version']} from {path}")
+    return calendars
+
+def parse_region_calendars(spec):
+    """Разбор соответствия регионов календарям вида 'default=ru,Минск=by'."""
+    mapping = {'default': 'ru'}
+    for item in (spec or '').split(','):
+        region, _, name = item.partition('=')
+        if region.strip() and name.strip():
+            mapping[region.strip()] = name.strip()
+    return mapping
+
+def apply_holiday_calendars(df, calendars, region_calendars):
+    """Расчёт признаков выходных и праздников по дате и календарю региона."""
+    logger.info("Computing weekend and holiday features from calendars")
+
+    is_weekend = np.zeros(len(df), dtype=bool)
+    is_holiday = np.zeros(len(df), dtype=bool)
+    days_to_next = np.full(len(df), np.nan)
+    days_since_last = np.full(len(df), np.nan)
+
+    positions = pd.Series(np.arange(len(df)), index=df.index)
+    for region, idx in df.groupby('region').groups.items():
+        name = region_calendars.get(region, region_calendars.get('default'))
+        cal = calendars.get(name)
+        if cal is None:
+            raise ValueError(f"Holiday calendar '{name}' for region '{region}' is not loaded")
+
+        rows = positions.loc[idx].values
+        dates = pd.DatetimeIndex(df.loc[idx, 'date']).normalize()
+        uncovered = set(dates.year) - cal['years']
+        if cal['years'] and uncovered:
+            logger.warning(f"Calendar '{name}' does not cover years {sorted(uncovered)} used in region '{region}'")
+
+        # Выходные с учётом перенесённых рабочих дней
+        is_weekend[rows] = dates.dayofweek.isin(cal['weekend_days']) & ~dates.isin(cal['working_days'])
+        is_holiday[rows] = dates.isin(cal['holidays'])
+
+        holidays = cal['holidays'].values
+        if len(holidays) == 0:
+            continue
+        values = dates.values
+        next_pos = np.searchsorted(holidays, values, side='left')
+        to_next = (holidays[np.minimum(next_pos, len(holidays) - 1)] - values) / np.timedelta64(1, 'D')
+        days_to_next[rows] = np.where(next_pos < len(holidays), to_next, np.nan)
+        last_pos = np.searchsorted(holidays, values, side='right') - 1
+        since_last = (values - holidays[np.maximum(last_pos, 0)]) / np.timedelta64(1, 'D')
+        days_since_last[rows] = np.where(last_pos >= 0, since_last, np.nan)
+
+    df['is_weekend'] = is_weekend
+    df['is_holiday'] = is_holiday
+    df['days_to_next_holiday'] = days_to_next
+    df['days_since_last_holiday'] = days_since_last
+    return df
+
+# Агрегаты уровней иерархии: колонка источника и функция агрегации
+HIERARCHY_AGGREGATIONS = {
+    'sales_total': ('sales_quantity', 'sum'),
+    'price_mean': ('price', 'mean'),
+    'price_median': ('price', 'median'),
+}
+
+def add_hierarchy_features(df, hierarchy, cross_region_label=None):
+    """Агрегаты по категориям, брендам и другим уровням за ту же дату, присоединённые к строкам продуктов.
+
+    Используются только строки той же даты, поэтому будущие данные в признаки не попадают.
+    """
+    logger.info("Creating hierarchical aggregate features")
+
+    # Агрегированные по регионам ряды не участвуют в расчёте, чтобы не учитывать продажи дважды
+    base = df if cross_region_label is None else df[df['region'] != cross_region_label]
+
+    aggregations = hierarchy.get('aggregations') or []
+    share_of = hierarchy.get('share_of')
+    price_relative_to = hierarchy.get('price_relative_to')
+
+    for level in hierarchy.get('levels', []):
+        name, keys = level['name'], list(level['keys'])
+
+        needed = list(aggregations)
+        if share_of == name and 'sales_total' not in needed:
+            needed.append('sales_total')
+        if price_relative_to == name and 'price_median' not in needed:
+            needed.append('price_median')
+        if not needed:
+            continue
+
+        named_aggregations = {f'{name}_{agg}': HIERARCHY_AGGREGATIONS[agg] for agg in needed}
+        table = base.groupby(keys + ['date']).agg(**named_aggregations).reset_index()
+        df = df.merge(table, on=keys + ['date'], how='left')
+
+        if share_of == name:
+            df[f'{name}_sales_share'] = (df['sales_quantity'] / df[f'{name}_sales_total']).replace([np.inf, -np.inf], np.nan)
+        if price_relative_to == name:
+            df[f'{name}_price_ratio_median'] = (df['price'] / df[f'{name}_price_median']).replace([np.inf, -np.inf], np.nan)
+
+        # Вспомогательные агрегаты, не объявленные в спецификации, удаляются
+        helpers = [f'{name}_{agg}' for agg in needed if agg not in aggregations]
+        df = df.drop(columns=helpers)
+
+    return df
+
+def load_feature_spec(path):
+    """Загрузка спецификации признаков (JSON от сервиса или исходный YAML)."""
+    logger.info(f"Loading feature spec from {path}")
+    with open(path, 'r', encoding='utf-8') as f:
+        if path.endswith(('.yaml', '.yml')):
+            import yaml  # PyYAML нужен только при запуске скрипта напрямую на YAML-спецификации
+            return yaml.safe_load(f)
+        return json.load(f)
+
+def create_features(df, spec):
+    """Создание признаков для модели по спецификации."""
     logger.info("Creating features")
 
     # Добавление временных признаков
@@ -73,96 +390,590 @@ def create_features(df):
     df['month'] = df['date'].dt.month
     df['quarter'] = df['date'].dt.quarter
 
-    # Сортировка данных
-    df = df.sort_values(['product_name', 'date'])
+    # Сортировка данных: все лаги, окна и цели считаются внутри ряда
+    series_key = list(spec.get('series_key') or DEFAULT_SERIES_KEY)
+    df = df.sort_values(series_key + ['date'])
+    grouped = df.groupby(series_key, sort=False)
 
-    # Лаги и скользящие средние
-    lag_periods = [1, 3, 7]
-    rolling_periods = [3, 7]
-
-    for product in df['product_name'].unique():
-        product_df = df[df['product_name'] == product]
-        if len(product_df) < 7:  # Уменьшен порог до 7 записей
-            continue
+    new_columns = {}
+    for feature in spec.get('features', []):
+        source = feature['source']
 
         # Лаги
-        for lag in lag_periods:
-            df.loc[df['product_name'] == product, f'sales_quantity_lag_{lag}'] = product_df['sales_quantity'].shift(lag)
-            df.loc[df['product_name'] == product, f'price_lag_{lag}'] = product_df['price'].shift(lag)
-
-        # Скользящие средние
-        for window in rolling_periods:
-            df.loc[df['product_name'] == product, f'sales_quantity_rolling_mean_{window}'] = (
-                product_df['sales_quantity'].rolling(window=window).mean().values
-            )
-            df.loc[df['product_name'] == product, f'price_rolling_mean_{window}'] = (
-                product_df['price'].rolling(window=window).mean().values
+        for lag in feature.get('lags') or []:
+            new_columns[f'{source}_lag_{lag}'] = grouped[source].shift(lag)
+
+        # Скользящие агрегаты
+        rolling = feature.get('rolling') or {}
+        for window in rolling.get('windows') or []:
+            for agg in rolling.get('aggregations') or []:
+                new_columns[f'{source}_rolling_{agg}_{window}'] = grouped[source].transform(
+                    lambda x: x.rolling(window=window).agg(agg)
+                )
+
+        # Экспоненциально взвешенные средние
+        for span in (feature.get('ewm') or {}).get('spans') or []:
+            new_columns[f'{source}_ewm_{span}'] = grouped[source].transform(
+                lambda x: x.ewm(span=span, adjust=False).mean()
             )
 
-    # Целевые переменные: прогнозирование за 7 дней
-    for product in df['product_name'].unique():
-        product_df = df[df['product_name'] == product].copy()
-        # Изменение цены через 7 дней
-        df.loc[df['product_name'] == product, 'price_target'] = product_df['price'].shift(-7)
-        # Суммарный спрос за следующие 7 дней
-        df.loc[df['product_name'] == product, 'sales_target'] = product_df['sales_quantity'].rolling(
-            window=7, min_periods=1
-        ).sum().shift(-7)
-
-    # Фильтрация продуктов с менее чем 7 записями
-    product_counts = df.groupby('product_name').size()
-    df = df[df['product_name'].isin(product_counts[product_counts >= 7].index)]
-    
-    # Заполняем пропущенные значения целевых переменных нулями, чтобы избежать ошибок при сохранении в БД
-    df['price_target'] = df['price_target'].fillna(0)
-    df['sales_target'] = df['sales_target'].fillna(0)
-    
-    # Убедимся, что все строковые значения не содержат проблемных символов для БД
-    string_columns = df.select_dtypes(include=['object']).columns
+        # Относительное изменение за n наблюдений
+        for period in (feature.get('pct_change') or {}).get('periods') or []:
+            previous = grouped[source].shift(period)
+            new_columns[f'{source}_pct_change_{period}'] = (df[source] / previous - 1).replace([np.inf, -np.inf], np.nan)
+
+        # Абсолютное изменение за n наблюдений
+        for period in (feature.get('diff') or {}).get('periods') or []:
+            new_columns[f'{source}_diff_{period}'] = df[source] - grouped[source].shift(period)
+
+        # Число дней с последнего изменения значения
+        if feature.get('days_since_change'):
+            changed = df[source].ne(grouped[source].shift())
+            change_date = df['date'].where(changed).groupby([df[k] for k in series_key]).ffill()
+            new_columns[f'{source}_days_since_change'] = (df['date'] - change_date).dt.days
+
+        # Скорость изменения в сутки за окно наблюдений
+        for window in (feature.get('velocity') or {}).get('windows') or []:
+            elapsed_days = (df['date'] - grouped['date'].shift(window)).dt.days
+            new_columns[f'{source}_velocity_{window}'] = (df[source] - grouped[source].shift(window)) / elapsed_days
+
+    # Целевые переменные для каждого горизонта: значение через horizon наблюдений
+    # (point) или агрегат по следующим horizon наблюдениям (sum, mean, max)
+    targets = spec.get('targets', [])
+    target_columns = []
+    for target in targets:
+        source, agg = target['source'], target['aggregation']
+        for horizon in target['horizons']:
+            column = f"{target['name']}_h{horizon}"
+            target_columns.append(column)
+            if agg == 'point':
+                new_columns[column] = grouped[source].shift(-horizon)
+            else:
+                new_columns[column] = grouped[source].transform(
+                    lambda x: x.rolling(window=horizon, min_periods=1).agg(agg).shift(-horizon)
+                )
+
+    df = pd.concat([df, pd.DataFrame(new_columns, index=df.index)], axis=1)
+
+    # Фильтрация рядов с недостаточной историей
+    min_history = spec.get('min_history', 7)
+    series_counts = df.groupby(series_key)['date'].transform('size')
+    df = df[series_counts >= min_history].copy()
+
+    # Заполнение пропусков целевых переменных, чтобы избежать ошибок при сохранении в БД
+    for target in targets:
+        if target.get('fill_value') is not None:
+            for horizon in target['horizons']:
+                column = f"{target['name']}_h{horizon}"
+                df[column] = df[column].fillna(target['fill_value'])
+
+    # Ограничение длины строковых значений под размер колонок БД (название продукта хранится полностью)
+    string_columns = df.select_dtypes(include=['object']).columns.difference(['product_id', 'product_name'])
     for col in string_columns:
-        df[col] = df[col].str.replace("'", "").str.replace('"', "").str.slice(0, 254)
-    
-    return df.dropna(subset=['price_target', 'sales_target'], how='all')
+        df[col] = df[col].map(lambda value: value[:254] if isinstance(value, str) else value)
+
+    if target_columns:
+        df = df.dropna(subset=target_columns, how='all')
+    return df
+
+SPLIT_STRATEGIES = ('cutoff', 'relative', 'three_way', 'rolling', 'expanding', 'product_holdout')
+SPLIT_NAMES = ('train', 'validation', 'test')
+
+def _is_holdout_product(product_id, fraction):
+    """Стабильное отнесение продукта к отложенной выборке по хешу product_id."""
+    digest = hashlib.sha256(str(product_id).encode('utf-8')).hexdigest()
+    return int(digest[:8], 16) / 0xFFFFFFFF < fraction
+
+def split_dataset(df, split):
+    """Разделение данных по выбранной стратегии.
+
+    Возвращает словарь выборок (train, validation, test) и описание фолдов кросс-валидации.
+    Строки попадают в test фолда k получают fold_id = k, остальные -1. Между обучающими
+    данными и следующей за ними выборкой пропускается gap_days дней, чтобы цели обучающих
+    строк не заглядывали в отложенный период.
+    """
+    strategy = split['strategy']
+    dates = df['date']
+    gap = pd.Timedelta(days=split.get('gap_days', 0))
+    df['fold_id'] = -1
+    folds = []
+
+    if strategy == 'cutoff':
+        cutoff = pd.Timestamp(split['cutoff'])
+        splits = {'train': df[dates < cutoff - gap], 'test': df[dates >= cutoff]}
+    elif strategy == 'relative':
+        # Последние test_days дней уходят в test
+        test_start = dates.max() - pd.Timedelta(days=split['test_days'] - 1)
+        splits = {'train': df[dates < test_start - gap], 'test': df[dates >= test_start]}
+    elif strategy == 'three_way':
+        test_start = dates.max() - pd.Timedelta(days=split['test_days'] - 1)
+        validation_start = test_start - gap - pd.Timedelta(days=split['validation_days'])
+        splits = {
+            'train': df[dates < validation_start - gap],
+            'validation': df[(dates >= validation_start) & (dates < test_start - gap)],
+            'test': df[dates >= test_start],
+        }
+    elif strategy in ('rolling', 'expanding'):
+        # Фолды идут от старых к новым, тестовые окна длиной fold_days примыкают друг к другу
+        fold_days = pd.Timedelta(days=split['fold_days'])
+        n_folds = split['folds']
+        for k in range(n_folds):
+            test_end = dates.max() - fold_days * (n_folds - 1 - k)
+            test_start = test_end - fold_days + pd.Timedelta(days=1)
+            train_end = test_start - gap
+            train_start = train_end - pd.Timedelta(days=split['train_days']) if strategy == 'rolling' else dates.min()
+            train_mask = (dates >= train_start) & (dates < train_end)
+            test_mask = (dates >= test_start) & (dates <= test_end)
+            df.loc[test_mask, 'fold_id'] = k
+            folds.append({
+                'fold_id': k,
+                'train_start': train_start.strftime('%Y-%m-%d'),
+                'train_end': (train_end - pd.Timedelta(days=1)).strftime('%Y-%m-%d'),
+                'test_start': test_start.strftime('%Y-%m-%d'),
+                'test_end': test_end.strftime('%Y-%m-%d'),
+                'train_mask': train_mask,
+                'test_mask': test_mask,
+            })
+        # Основные train/test соответствуют последнему фолду
+        last = folds[-1]
+        splits = {'train': df[last['train_mask']], 'test': df[last['test_mask']]}
+    elif strategy == 'product_holdout':
+        holdout = df['product_id'].map(lambda pid: _is_holdout_product(pid, split['holdout_fraction']))
+        splits = {'train': df[~holdout], 'test': df[holdout]}
+    else:
+        raise ValueError(f"Unknown split strategy: {strategy}")
+
+    for name, part in splits.items():
+        logger.info(f"Split {strategy}: {len(part)} rows in {name}")
+    return splits, folds
+
+def save_folds(df, folds, output_dir):
+    """Сохранение каждого фолда в отдельные файлы и описания фолдов в folds.json."""
+    folds_dir = os.path.join(output_dir, 'folds')
+    shutil.rmtree(folds_dir, ignore_errors=True)
+    if not folds:
+        return
+
+    os.makedirs(folds_dir)
+    summary = []
+    for fold in folds:
+        k = fold['fold_id']
+        for name in ('train', 'test'):
+            part = df[fold[f'{name}_mask']].copy()
+            part['date'] = part['date'].dt.strftime('%Y-%m-%d')
+            part.to_csv(os.path.join(folds_dir, f'fold_{k}_{name}.csv'), index=False)
+            fold[f'{name}_rows'] = len(part)
+        summary.append({key: value for key, value in fold.items() if not key.endswith('_mask')})
+
+    with open(os.path.join(folds_dir, 'folds.json'), 'w', encoding='utf-8') as f:
+        json.dump(summary, f, ensure_ascii=False, indent=2)
+    logger.info(f"Saved {len(folds)} cross-validation folds to {folds_dir}")
+
+ENCODING_SEED = 42
+
+def _target_stats(values, target):
+    """Сглаживаемые статистики цели по категориям: сумма и число наблюдений."""
+    known = target.notna()
+    return target[known].groupby(values[known]).agg(['sum', 'count'])
+
+def fit_encoders(train_df, encoding):
+    """Обучение кодировщиков категориальных признаков только на тренировочной выборке."""
+    encoders = {}
+    for config in (encoding or {}).get('columns', []):
+        column, method = config['column'], config['method']
+        values = train_df[column].astype(str).where(train_df[column].notna())
+        vocabulary = sorted(values.dropna().unique())
+        encoder = {'method': method, 'vocabulary': vocabulary}
+
+        if method == 'target':
+            target = train_df[config['target']]
+            global_mean = float(target.mean()) if target.notna().any() else 0.0
+            smoothing = config['smoothing']
+            stats = _target_stats(values, target)
+            encoder.update({
+                'target': config['target'],
+                'folds': config['folds'],
+                'smoothing': smoothing,
+                'global_mean': global_mean,
+                'mapping': {
+                    value: float((row['sum'] + smoothing * global_mean) / (row['count'] + smoothing))
+                    for value, row in stats.iterrows()
+                },
+            })
+
+        encoders[column] = encoder
+        logger.info(f"Fitted {method} encoder for {column} with {len(vocabulary)} values")
+    return encoders
 
-def process_data(input_file, output_dir, cutoff_date):
-    """Основная функция обработки данных."""
+def apply_encoders(df, encoders, out_of_fold=False):
+    """Применение кодировщиков. Для тренировочной выборки целевое кодирование считается
+    вне фолда, чтобы значение строки не зависело от её собственной цели."""
+    new_columns = {}
+    for column, encoder in encoders.items():
+        values = df[column].astype(str).where(df[column].notna())
+        vocabulary = encoder['vocabulary']
+
+        if encoder['method'] == 'label':
+            # Неизвестные и пустые значения кодируются как -1
+            index = {value: i for i, value in enumerate(vocabulary)}
+            new_columns[f'{column}_label'] = values.map(index).fillna(-1).astype(int)
+        elif encoder['method'] == 'onehot':
+            for i, value in enumerate(vocabulary):
+                new_columns[f'{column}_onehot_{i}'] = (values == value).astype(int)
+        elif encoder['method'] == 'target':
+            global_mean, smoothing = encoder['global_mean'], encoder['smoothing']
+            encoded = values.map(encoder['mapping']).fillna(global_mean)
+            if out_of_fold and len(df) > 0:
+                target = df[encoder['target']]
+                folds = np.random.default_rng(ENCODING_SEED).integers(0, encoder['folds'], len(df))
+                total = _target_stats(values, target)
+                for fold in range(encoder['folds']):
+                    in_fold = folds == fold
+                    # Статистики остальных фолдов = общие минус статистики текущего фолда
+                    stats = total.sub(_target_stats(values[in_fold], target[in_fold]), fill_value=0)
+                    fold_mapping = (stats['sum'] + smoothing * global_mean) / (stats['count'] + smoothing)
+                    encoded[in_fold] = values[in_fold].map(fold_mapping).fillna(global_mean)
+            new_columns[f'{column}_target_enc'] = encoded.astype(float)
+
+    if not new_columns:
+        return df
+    return pd.concat([df, pd.DataFrame(new_columns, index=df.index)], axis=1)
+
+SCALING_QUANTILES = (0.25, 0.75)
+
+def fit_scalers(train_df, scaling):
+    """Обучение масштабирования числовых признаков только на тренировочной выборке.
+
+    Каждый метод сводится к (x - center) / scale: standard - среднее и стандартное отклонение,
+    minmax - минимум и размах, robust - медиана и межквартильный размах.
+    """
+    scalers = {}
+    for config in (scaling or {}).get('columns', []):
+        column, method = config['column'], config['method']
+        if column not in train_df.columns:
+            raise ValueError(f"Scaled column {column} is not in the dataset")
+        values = pd.to_numeric(train_df[column], errors='coerce').dropna()
+
+        if method == 'standard':
+            stats = {'mean': values.mean(), 'std': values.std(ddof=0)}
+            center, scale = stats['mean'], stats['std']
+        elif method == 'minmax':
+            stats = {'min': values.min(), 'max': values.max()}
+            center, scale = stats['min'], stats['max'] - stats['min']
+        else:
+            q_low, q_high = values.quantile(list(SCALING_QUANTILES)) if len(values) else (np.nan, np.nan)
+            stats = {'median': values.median(), 'q25': q_low, 'q75': q_high}
+            center, scale = stats['median'], q_high - q_low
+
+        # Постоянный или пустой столбец не масштабируется, а только сдвигается
+        center = 0.0 if pd.isna(center) else float(center)
+        scale = 1.0 if pd.isna(scale) or scale == 0 else float(scale)
+        scalers[column] = {
+            'method': method,
+            'center': center,
+            'scale': scale,
+            'stats': {key: _json_number(value) for key, value in stats.items()},
+        }
+        logger.info(f"Fitted {method} scaler for {column}: center {center:.4g}, scale {scale:.4g}")
+    return scalers
+
+def apply_scalers(df, scalers):
+    """Добавление масштабированных копий столбцов <column>_scaled, исходные столбцы сохраняются."""
+    new_columns = {
+        f'{column}_scaled': (pd.to_numeric(df[column], errors='coerce') - scaler['center']) / scaler['scale']
+        for column, scaler in scalers.items()
+    }
+    if not new_columns:
+        return df
+    return pd.concat([df, pd.DataFrame(new_columns, index=df.index)], axis=1)
+
+def save_run_artifact(name, items, output_dir, run_id, spec_version):
+    """Сохранение обученных преобразований (<name>.json) рядом с train_data.csv
+    и версионной копии в artifacts/<run_id>."""
+    artifact = {
+        'run_id': run_id,
+        'spec_version': spec_version,
+        'created_at': datetime.now().strftime('%Y-%m-%dT%H:%M:%S'),
+        name: items,
+    }
+    run_dir = os.path.join(output_dir, 'artifacts', run_id)
+    os.makedirs(run_dir, exist_ok=True)
+    for path in (os.path.join(output_dir, f'{name}.json'), os.path.join(run_dir, f'{name}.json')):
+        with open(path, 'w', encoding='utf-8') as f:
+            json.dump(artifact, f, ensure_ascii=False, indent=2)
+    logger.info(f"{name.capitalize()} saved to {run_dir}")
+
+def _json_number(value):
+    """Приведение числового значения к JSON-совместимому виду (NaN -> None)."""
+    if value is None or pd.isna(value):
+        return None
+    return float(value)
+
+def profile_dataset(df, top_k=10):
+    """Профилирование набора данных по колонкам и покрытию дат по продуктам."""
+    logger.info("Profiling processed dataset")
+
+    total = len(df)
+    columns = {}
+    for col in df.columns:
+        series = df[col]
+        null_count = int(series.isna().sum())
+        column_profile = {
+            'dtype': str(series.dtype),
+            'count': int(series.count()),
+            'null_rate': (null_count / total) if total else 0.0,
+        }
+
+        if pd.api.types.is_bool_dtype(series) or not pd.api.types.is_numeric_dtype(series):
+            if pd.api.types.is_datetime64_any_dtype(series):
+                column_profile['kind'] = 'datetime'
+                column_profile['min'] = series.min().strftime('%Y-%m-%d') if series.count() else None
+                column_profile['max'] = series.max().strftime('%Y-%m-%d') if series.count() else None
+            else:
+                column_profile['kind'] = 'categorical'
+                counts = series.astype(str).where(series.notna()).value_counts().head(top_k)
+                column_profile['unique'] = int(series.nunique())
+                column_profile['top_values'] = [
+                    {'value': value, 'count': int(count)} for value, count in counts.items()
+                ]
+        else:
+            column_profile['kind'] = 'numeric'
+            quantiles = series.quantile([0.05, 0.25, 0.5, 0.75, 0.95])
+            column_profile.update({
+                'min': _json_number(series.min()),
+                'max': _json_number(series.max()),
+                'mean': _json_number(series.mean()),
+                'stddev': _json_number(series.std()),
+                'quantiles': {f'p{int(q * 100)}': _json_number(v) for q, v in quantiles.items()},
+            })
+        columns[col] = column_profile
+
+    # Покрытие дат по каждому продукту
+    coverage = []
+    if total and 'date' in df.columns and 'product_id' in df.columns:
+        for product, group in df.groupby('product_id'):
+            first_date, last_date = group['date'].min(), group['date'].max()
+            expected_days = (last_date - first_date).days + 1
+            observed_days = int(group['date'].nunique())
+            coverage.append({
+                'product_id': product,
+                'product_name': group['product_name'].iloc[-1],
+                'first_date': first_date.strftime('%Y-%m-%d'),
+                'last_date': last_date.strftime('%Y-%m-%d'),
+                'observed_days': observed_days,
+                'expected_days': expected_days,
+                'coverage': observed_days / expected_days if expected_days else 0.0,
+            })
+
+    return {
+        'generated_at': datetime.now().isoformat(timespec='seconds'),
+        'row_count': total,
+        'column_count': len(df.columns),
+        'columns': columns,
+        'date_coverage': coverage,
+    }
+
+def render_profile_html(profile):
+    """Формирование HTML-отчёта по профилю набора данных."""
+    def fmt(value):
+        if value is None:
+            return ''
+        if isinstance(value, float):
+            return f'{value:.4g}'
+        return html.escape(str(value))
+
+    rows = []
+    for name, col in profile['columns'].items():
+        if col['kind'] == 'numeric':
+            quantiles = ', '.join(f"{k}={fmt(v)}" for k, v in col['quantiles'].items())
+            details = f"min={fmt(col['min'])}, max={fmt(col['max'])}, mean={fmt(col['mean'])}, " \
+                      f"std={fmt(col['stddev'])}; {quantiles}"
+        elif col['kind'] == 'categorical':
+            details = ', '.join(f"{fmt(v['value'])} ({v['count']})" for v in col['top_values'])
+        else:
+            details = f"{fmt(col['min'])} &ndash; {fmt(col['max'])}"
+        rows.append(
+            f"<tr><td>{html.escape(name)}</td><td>{col['kind']}</td><td>{col['count']}</td>"
+            f"<td>{col['null_rate']:.2%}</td><td>{details}</td></tr>"
+        )
+
+    coverage_rows = [
+        f"<tr><td>{html.escape(str(c['product_name']))}</td><td>{c['first_date']}</td><td>{c['last_date']}</td>"
+        f"<td>{c['observed_days']}/{c['expected_days']}</td><td>{c['coverage']:.2%}</td></tr>"
+        for c in profile['date_coverage']
+    ]
+
+    return f"""<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Dataset profile</title>
+<style>body{{font-family:sans-serif}}table{{border-collapse:collapse}}td,th{{border:1px solid #ccc;padding:4px 8px}}</style>
+</head>
+<body>
+<h1>Dataset profile</h1>
+<p>Generated at {profile['generated_at']}: {profile['row_count']} rows, {profile['column_count']} columns</p>
+<h2>Columns</h2>
+<table><tr><th>Column</th><th>Kind</th><th>Count</th><th>Null rate</th><th>Summary</th></tr>
+{''.join(rows)}
+</table>
+<h2>Date coverage</h2>
+<table><tr><th>Product</th><th>First date</th><th>Last date</th><th>Days</th><th>Coverage</th></tr>
+{''.join(coverage_rows)}
+</table>
+</body>
+</html>
+"""
+
+def save_profile(profile, output_dir):
+    """Сохранение профиля в JSON и HTML рядом с train_data.csv."""
+    with open(os.path.join(output_dir, 'profile.json'), 'w', encoding='utf-8') as f:
+        json.dump(profile, f, ensure_ascii=False, indent=2)
+    with open(os.path.join(output_dir, 'profile.html'), 'w', encoding='utf-8') as f:
+        f.write(render_profile_html(profile))
+    logger.info(f"Dataset profile saved to {output_dir}")
+
+def process_data(input_file, output_dir, split, spec, profile_top_k=10, fill_strategies=None,
+                 calendars=None, region_calendars=None, exchange_rates=None, base_currency='RUB', run_id=None,
+                 records=None, progress=None):
+    """Основная функция обработки данных.
+
+    records — уже загруженные записи пакета (вместо чтения input_file),
+    progress — функция progress(step, **fields) для отчёта о ходе обработки.
+    Возвращает пути и число строк сохранённых выборок, при ошибке выбрасывает исключение.
+    """
+    progress = progress or (lambda step, **fields: None)
     try:
         # Загрузка и обработка данных
-        df = load_data(input_file)
+        progress('load')
+        df = pd.DataFrame(records) if records is not None else load_data(input_file)
+        df = convert_currencies(df, load_exchange_rates(exchange_rates), base_currency)
+        progress('preprocess', rows=len(df))
         df = preprocess_data(df)
-        df = create_features(df)
+        series_key = spec.get('series_key') or DEFAULT_SERIES_KEY
+        df = aggregate_series(df, series_key)
+        if fill_strategies is not None:
+            df = fill_calendar_gaps(df, fill_strategies, series_key)
+        else:
+            df['is_imputed'] = False
+        cross_region = spec.get('cross_region') or {}
+        if cross_region.get('enabled'):
+            df = add_cross_region_series(df, cross_region.get('region_label', '__all__'))
+        if calendars is not None:
+            df = apply_holiday_calendars(df, calendars, region_calendars)
+        if spec.get('hierarchy'):
+            cross_region_label = cross_region.get('region_label', '__all__') if cross_region.get('enabled') else None
+            df = add_hierarchy_features(df, spec['hierarchy'], cross_region_label)
+        progress('features', rows=len(df))
+        df = create_features(df, spec)
+        profile = profile_dataset(df, profile_top_k)
 
-        # Разделение на тренировочную и тестовую выборки
-        train_df = df[df['date'] < cutoff_date]
-        test_df = df[df['date'] >= cutoff_date]
+        # Разделение на выборки по выбранной стратегии
+        max_horizon = max((h for t in spec.get('targets', []) for h in t['horizons']), default=0)
+        if split['strategy'] != 'product_holdout' and split.get('gap_days', 0) < max_horizon:
+            logger.warning(f"Split gap of {split.get('gap_days', 0)} days is shorter than the longest target "
+                           f"horizon ({max_horizon}), targets of the last training rows overlap the next split")
+        progress('split', rows=len(df))
+        splits, folds = split_dataset(df, split)
 
-        # Convert dates to string format for CSV export
-        train_df['date'] = train_df['date'].dt.strftime('%Y-%m-%d')
-        test_df['date'] = test_df['date'].dt.strftime('%Y-%m-%d')
+        # Кодирование категориальных признаков по словарям тренировочной выборки
+        encoders = fit_encoders(splits['train'], spec.get('encoding'))
+        if encoders:
+            splits = {
+                name: apply_encoders(part, encoders, out_of_fold=(name == 'train'))
+                for name, part in splits.items()
+            }
 
-        # Сохранение данных
+        # Масштабирование по параметрам тренировочной выборки
+        scalers = fit_scalers(splits['train'], spec.get('scaling'))
+        if scalers:
+            splits = {name: apply_scalers(part, scalers) for name, part in splits.items()}
+
+        # Сохранение данных; файлы выборок, не созданных этой стратегией, удаляются
+        progress('save')
         os.makedirs(output_dir, exist_ok=True)
-        train_df.to_csv(os.path.join(output_dir, 'train_data.csv'), index=False)
-        test_df.to_csv(os.path.join(output_dir, 'test_data.csv'), index=False)
+        result = {'files': {}, 'rows': {}}
+        for name in SPLIT_NAMES:
+            path = os.path.join(output_dir, f'{name}_data.csv')
+            if name not in splits:
+                if os.path.exists(path):
+                    os.remove(path)
+                continue
+            part = splits[name].copy()
+            part['date'] = part['date'].dt.strftime('%Y-%m-%d')
+            part.to_csv(path, index=False)
+            result['files'][name] = path
+            result['rows'][name] = len(part)
+        save_folds(df, folds, output_dir)
+        save_profile(profile, output_dir)
+        run_id = run_id or datetime.now().strftime('%Y%m%d_%H%M%S')
+        if encoders:
+            save_run_artifact('encoders', encoders, output_dir, run_id, spec.get('version'))
+        if scalers:
+            save_run_artifact('scalers', scalers, output_dir, run_id, spec.get('version'))
         logger.info(f"Data saved to {output_dir}")
-        return True
+        return result
     except Exception as e:
         logger.error(f"Error in processing: {e}")
-        return False
+        raise
 
-if __name__ == "__main__":
-    # Парсинг аргументов командной строки
+def parse_args(argv=None):
+    """Парсинг аргументов командной строки; argv=None — аргументы процесса."""
     parser = argparse.ArgumentParser(description='Process marketplace data')
     parser.add_argument('--input', required=True, help='Path to input JSON file')
     parser.add_argument('--output', required=True, help='Output directory')
     parser.add_argument('--cutoff', default='2025-03-20', help='Cutoff date in YYYY-MM-DD format')
+    parser.add_argument('--split-strategy', default='cutoff', choices=SPLIT_STRATEGIES, help='Train/test split strategy')
+    parser.add_argument('--test-days', type=int, default=30, help='Days in the test split (relative, three_way)')
+    parser.add_argument('--validation-days', type=int, default=30, help='Days in the validation split (three_way)')
+    parser.add_argument('--folds', type=int, default=5, help='Number of cross-validation folds (rolling, expanding)')
+    parser.add_argument('--fold-days', type=int, default=30, help='Days in the test window of each fold')
+    parser.add_argument('--train-days', type=int, default=180, help='Days in the training window of each fold (rolling)')
+    parser.add_argument('--gap-days', type=int, default=0, help='Days skipped between training data and the following split')
+    parser.add_argument('--holdout-fraction', type=float, default=0.2, help='Share of products held out (product_holdout)')
+    parser.add_argument('--spec', required=True, help='Feature spec file (JSON, or YAML with PyYAML installed)')
+    parser.add_argument('--profile-top-k', type=int, default=10, help='Number of top values in categorical column profiles')
+    parser.add_argument('--fill-strategy', default='', help='Gap fill strategies as field=zero|ffill|interpolate, comma-separated')
+    parser.add_argument('--no-gap-fill', action='store_true', help='Disable calendar gap filling')
+    parser.add_argument('--calendar-dir', default=os.path.join(os.path.dirname(os.path.abspath(__file__)), 'calendars'),
+                        help='Directory with bundled holiday calendars')
+    parser.add_argument('--calendar-file', action='append', default=[], help='Custom holiday calendar file (repeatable)')
+    parser.add_argument('--region-calendars', default='', help='Region to calendar mapping as region=name, comma-separated')
+    parser.add_argument('--no-calendars', action='store_true', help='Pass is_weekend/is_holiday through unchanged')
+    parser.add_argument('--exchange-rates', default='', help='CSV file with date, currency and rate columns')
+    parser.add_argument('--base-currency', default='RUB', help='Currency all prices are converted to')
+    parser.add_argument('--run-id', default='', help='Run identifier used to version the fitted encoders and scalers')
 
-    args = parser.parse_args()
+    return parser.parse_args(argv)
 
-    # Запуск обработки
-    success = process_data(
+def run(args, records=None, progress=None):
+    """Запуск обработки с разобранными аргументами, общий для командной строки и воркера."""
+    return process_data(
         args.input,
         args.output,
-        datetime.strptime(args.cutoff, '%Y-%m-%d')
+        {
+            'strategy': args.split_strategy,
+            'cutoff': datetime.strptime(args.cutoff, '%Y-%m-%d'),
+            'test_days': args.test_days,
+            'validation_days': args.validation_days,
+            'folds': args.folds,
+            'fold_days': args.fold_days,
+            'train_days': args.train_days,
+            'gap_days': args.gap_days,
+            'holdout_fraction': args.holdout_fraction,
+        },
+        load_feature_spec(args.spec),
+        args.profile_top_k,
+        None if args.no_gap_fill else parse_fill_strategies(args.fill_strategy),
+        None if args.no_calendars else load_calendars(args.calendar_dir, args.calendar_file),
+        parse_region_calendars(args.region_calendars),
+        args.exchange_rates,
+        args.base_currency.upper(),
+        args.run_id or None,
+        records,
+        progress
     )
-    sys.exit(0 if success else 1)
\ No newline at end of file
+
+if __name__ == "__main__":
+    try:
+        run(parse_args())
+    except Exception:
+        sys.exit(1)
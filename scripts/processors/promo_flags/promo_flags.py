@@ -0,0 +1,47 @@
+"""Пример внешнего обработчика: добавляет столбец is_promo.
+
+Читает файлы <split>_data.csv из --input-dir и пишет файлы с теми же именами в --output-dir.
+Коды завершения: 0 — выборки записаны, 2 — входные данные непригодны, 3 — изменений нет.
+"""
+import argparse
+import csv
+import os
+import sys
+
+EXIT_INVALID_INPUT = 2
+EXIT_SKIPPED = 3
+
+
+def main():
+    parser = argparse.ArgumentParser(description='Mark promotional sales')
+    parser.add_argument('--input-dir', required=True)
+    parser.add_argument('--output-dir', required=True)
+    parser.add_argument('--run-id', default='')
+    parser.add_argument('--min-discount', type=float, default=10)
+    args = parser.parse_args()
+
+    files = sorted(f for f in os.listdir(args.input_dir) if f.endswith('_data.csv'))
+    if not files:
+        print('No split files found', file=sys.stderr)
+        sys.exit(EXIT_INVALID_INPUT)
+
+    # Столбец уже посчитан, например основным обработчиком — передаём данные без изменений
+    with open(os.path.join(args.input_dir, files[0]), newline='', encoding='utf-8') as f:
+        if 'is_promo' in next(csv.reader(f), []):
+            sys.exit(EXIT_SKIPPED)
+
+    for name in files:
+        with open(os.path.join(args.input_dir, name), newline='', encoding='utf-8') as src, \
+                open(os.path.join(args.output_dir, name), 'w', newline='', encoding='utf-8') as dst:
+            reader = csv.DictReader(src)
+            writer = csv.DictWriter(dst, fieldnames=reader.fieldnames + ['is_promo'])
+            writer.writeheader()
+            for row in reader:
+                discount = float(row['discount_percentage'] or 0)
+                row['is_promo'] = int(discount >= args.min_discount)
+                writer.writerow(row)
+        print(f'{name}: promo flags added', file=sys.stderr)
+
+
+if __name__ == "__main__":
+    main()
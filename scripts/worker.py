@@ -0,0 +1,146 @@
+"""Постоянный воркер обработки данных.
+
+Воркер один раз импортирует pandas и модуль обработчика и обслуживает запросы
+JSON-RPC 2.0, по одному JSON-объекту на строку: запросы читаются из stdin,
+ответы и уведомления пишутся в stdout. Логи и любой посторонний вывод идут в stderr.
+
+Методы:
+  ping      — состояние воркера: pid, интерпретатор, virtualenv, версии, время работы
+  process   — обработка пакета; params: args — аргументы командной строки обработчика,
+              records — записи пакета (необязательно, иначе читается --input);
+              результат — пути (files) и число строк (rows) сохранённых выборок
+  shutdown  — завершение после ответа
+
+Во время process воркер отправляет уведомления progress с полями id, step и rows.
+Ошибки обработки возвращаются с кодом -32000 и полями type и traceback в data.
+"""
+import argparse
+import importlib.util
+import json
+import os
+import platform
+import sys
+import time
+import traceback
+
+# Коды ошибок JSON-RPC 2.0
+PARSE_ERROR = -32700
+INVALID_REQUEST = -32600
+METHOD_NOT_FOUND = -32601
+INVALID_PARAMS = -32602
+PROCESSING_ERROR = -32000
+
+
+class InvalidParams(Exception):
+    """Некорректные параметры запроса."""
+
+
+def load_processor(path):
+    """Импорт модуля обработчика по пути к файлу."""
+    spec = importlib.util.spec_from_file_location('data_processor', path)
+    module = importlib.util.module_from_spec(spec)
+    spec.loader.exec_module(module)
+    return module
+
+
+class Worker:
+    def __init__(self, processor, out):
+        self.processor = processor
+        self.out = out
+        self.started = time.time()
+        self.running = True
+
+    def send(self, message):
+        """Отправка одного сообщения протокола."""
+        message['jsonrpc'] = '2.0'
+        self.out.write(json.dumps(message, ensure_ascii=False, default=str) + '\n')
+        self.out.flush()
+
+    def ping(self, request_id, params):
+        import pandas
+        return {
+            'pid': os.getpid(),
+            'python': platform.python_version(),
+            'executable': sys.executable,
+            'prefix': sys.prefix,
+            'virtualenv': sys.prefix != sys.base_prefix,
+            'pandas': pandas.__version__,
+            'uptime_seconds': round(time.time() - self.started, 3),
+        }
+
+    def process(self, request_id, params):
+        args = params.get('args')
+        if not isinstance(args, list):
+            raise InvalidParams('args must be a list of command line arguments')
+        records = params.get('records')
+        if records is not None and not isinstance(records, list):
+            raise InvalidParams('records must be a list')
+        try:
+            parsed = self.processor.parse_args([str(arg) for arg in args])
+        except SystemExit:
+            raise InvalidParams(f'invalid processor arguments: {" ".join(map(str, args))}')
+
+        def progress(step, **fields):
+            self.send({'method': 'progress', 'params': dict(fields, id=request_id, step=step)})
+
+        return self.processor.run(parsed, records, progress)
+
+    def shutdown(self, request_id, params):
+        self.running = False
+        return {}
+
+    def handle(self, line):
+        """Разбор и выполнение одного запроса."""
+        try:
+            request = json.loads(line)
+        except ValueError as e:
+            self.send({'id': None, 'error': {'code': PARSE_ERROR, 'message': str(e)}})
+            return
+        if not isinstance(request, dict) or not isinstance(request.get('method'), str):
+            self.send({'id': None, 'error': {'code': INVALID_REQUEST, 'message': 'invalid request'}})
+            return
+
+        request_id = request.get('id')
+        method = {'ping': self.ping, 'process': self.process, 'shutdown': self.shutdown}.get(request['method'])
+        if method is None:
+            self.send({'id': request_id, 'error': {'code': METHOD_NOT_FOUND, 'message': f"unknown method {request['method']}"}})
+            return
+
+        try:
+            result = method(request_id, request.get('params') or {})
+        except InvalidParams as e:
+            self.send({'id': request_id, 'error': {'code': INVALID_PARAMS, 'message': str(e)}})
+        except Exception as e:
+            self.send({'id': request_id, 'error': {
+                'code': PROCESSING_ERROR,
+                'message': str(e),
+                'data': {'type': type(e).__name__, 'traceback': traceback.format_exc()},
+            }})
+        else:
+            self.send({'id': request_id, 'result': result})
+
+    def serve(self, requests):
+        for line in requests:
+            if line.strip():
+                self.handle(line)
+            if not self.running:
+                break
+
+
+def main():
+    parser = argparse.ArgumentParser(description='Persistent data processing worker')
+    parser.add_argument('--processor', default=os.path.join(os.path.dirname(os.path.abspath(__file__)), 'data_processor.py'),
+                        help='Processor script exposing parse_args and run')
+    args = parser.parse_args()
+
+    # Протокол получает собственную копию stdout, а дескриптор 1 перенаправляется в stderr,
+    # чтобы print и вывод библиотек не ломали поток ответов
+    out = os.fdopen(os.dup(sys.stdout.fileno()), 'w', encoding='utf-8')
+    os.dup2(sys.stderr.fileno(), sys.stdout.fileno())
+
+    worker = Worker(load_processor(args.processor), out)
+    worker.serve(sys.stdin)
+
+
+if __name__ == "__main__":
+    main()
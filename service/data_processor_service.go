@@ -1,28 +1,46 @@
 package service
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/graduate-work-mirea/data-processor-service/config"
+	"github.com/graduate-work-mirea/data-processor-service/internal/featurespec"
+	"github.com/graduate-work-mirea/data-processor-service/internal/plugin"
 	"github.com/graduate-work-mirea/data-processor-service/repository"
 	"go.uber.org/zap"
 )
 
 // DataProcessorService handles data processing logic
 type DataProcessorService struct {
-	fileRepo     *repository.FileRepository
-	rabbitRepo   *repository.RabbitMQRepository
-	postgresRepo *repository.PostgresRepository
-	pythonPath   string
-	scriptPath   string
-	logger       *zap.SugaredLogger
-	cutoffDate   string
-	batchSize    int
-	consumeTime  time.Duration
+	fileRepo         *repository.FileRepository
+	rabbitRepo       *repository.RabbitMQRepository
+	postgresRepo     *repository.PostgresRepository
+	exchangeRateRepo *repository.ExchangeRateRepository
+	featureSpec      *featurespec.Spec
+	pythonPath       string
+	scriptPath       string
+	logger           *zap.SugaredLogger
+	options          ProcessorOptions
+	batchSize        int
+	consumeTime      time.Duration
+	pipeline         config.PipelineConfig
+	datasetEvents    config.DatasetEventsConfig
+	runHooks         []func(runID string)
+	// worker runs the processor instead of a new process per run when set
+	worker *PythonWorker
+	// processors are the external processors chained after the built-in one
+	processors []*plugin.Manifest
 }
 
 // NewDataProcessorService creates a new DataProcessorService instance
@@ -30,90 +48,116 @@ func NewDataProcessorService(
 	fileRepo *repository.FileRepository,
 	rabbitRepo *repository.RabbitMQRepository,
 	postgresRepo *repository.PostgresRepository,
+	exchangeRateRepo *repository.ExchangeRateRepository,
+	featureSpec *featurespec.Spec,
 	pythonPath string,
 	scriptPath string,
-	cutoffDate string,
+	options ProcessorOptions,
 	batchSize int,
 	consumeTime time.Duration,
+	pipeline config.PipelineConfig,
+	datasetEvents config.DatasetEventsConfig,
 	logger *zap.SugaredLogger,
 ) *DataProcessorService {
 	return &DataProcessorService{
-		fileRepo:     fileRepo,
-		rabbitRepo:   rabbitRepo,
-		postgresRepo: postgresRepo,
-		pythonPath:   pythonPath,
-		scriptPath:   scriptPath,
-		logger:       logger,
-		cutoffDate:   cutoffDate,
-		batchSize:    batchSize,
-		consumeTime:  consumeTime,
+		fileRepo:         fileRepo,
+		rabbitRepo:       rabbitRepo,
+		postgresRepo:     postgresRepo,
+		exchangeRateRepo: exchangeRateRepo,
+		featureSpec:      featureSpec,
+		pythonPath:       pythonPath,
+		scriptPath:       scriptPath,
+		logger:           logger,
+		options:          options,
+		batchSize:        batchSize,
+		consumeTime:      consumeTime,
+		pipeline:         pipeline,
+		datasetEvents:    datasetEvents,
 	}
 }
 
-// ProcessMarketplaceData processes marketplace data from RabbitMQ
+// OnRunCompleted registers a function called after each successful run
+func (s *DataProcessorService) OnRunCompleted(hook func(runID string)) {
+	s.runHooks = append(s.runHooks, hook)
+}
+
+// UseWorker makes the transform stage send batches to a long-lived Python worker
+func (s *DataProcessorService) UseWorker(worker *PythonWorker) {
+	s.worker = worker
+}
+
+// ProcessMarketplaceData runs the staged pipeline on a new batch from RabbitMQ.
+// Failed runs are resumed first, so batches are loaded in the order they were consumed.
 func (s *DataProcessorService) ProcessMarketplaceData(ctx context.Context) error {
 	s.logger.Info("Starting to process marketplace data")
 
-	// Consume messages from RabbitMQ
-	data, err := s.rabbitRepo.ConsumeMessages(ctx, s.batchSize, s.consumeTime)
-	if err != nil {
-		return fmt.Errorf("failed to consume messages: %w", err)
+	if err := s.resumeUnfinishedRuns(ctx); err != nil {
+		return err
 	}
 
-	if len(data) == 0 {
-		s.logger.Info("No new data to process")
-		return nil
+	run := s.newRun()
+	if err := s.executeRun(ctx, run); err != nil {
+		if errors.Is(err, errNoNewData) {
+			if err := s.fileRepo.RemoveRun(run.RunID); err != nil {
+				s.logger.Warnf("Failed to remove empty run %s: %v", run.RunID, err)
+			}
+			s.logger.Info("No new data to process")
+			return nil
+		}
+		return err
 	}
 
-	s.logger.Infof("Consumed %d messages from RabbitMQ", len(data))
-
-	// Generate timestamp for the raw data file
-	timestamp := time.Now().Format("20060102_150405")
-	rawFilename := fmt.Sprintf("marketplace_data_%s.json", timestamp)
-	rawFilePath := filepath.Join(s.fileRepo.GetRawDataPath(), rawFilename)
-
-	// Save raw data to file
-	if err := s.fileRepo.SaveMarketplaceData(data, rawFilePath); err != nil {
-		return fmt.Errorf("failed to save raw data: %w", err)
-	}
+	s.logger.Info("Data processing completed successfully")
+	return nil
+}
 
-	s.logger.Infof("Saved raw data to %s", rawFilePath)
+// runPythonProcessor runs the Python data processing script.
+// The process and its children run in their own process group, which is killed when ctx is cancelled
+// or the maximum runtime is exceeded. A failed run is reported as a *ProcessorError.
+func (s *DataProcessorService) runPythonProcessor(ctx context.Context, runID string, inputFile string, ratesFile string) error {
+	s.logger.Infof("Running Python data processor with input: %s, output: %s", inputFile, s.fileRepo.GetProcessedDataPath())
 
-	// Process data using Python script
-	if err := s.runPythonProcessor(rawFilePath); err != nil {
-		return fmt.Errorf("failed to process data: %w", err)
+	// Prepare command
+	args, err := s.processorArgs(runID, inputFile, ratesFile)
+	if err != nil {
+		return err
 	}
+	args = append([]string{s.scriptPath}, args...)
 
-	// Save processed data to PostgreSQL if repository is available
-	if s.postgresRepo != nil {
-		if err := s.saveProcessedDataToPostgres(); err != nil {
-			s.logger.Warnf("Failed to save processed data to PostgreSQL: %v", err)
-			s.logger.Warn("Continuing without saving to database, data is still saved to files")
-		} else {
-			s.logger.Info("Successfully saved processed data to PostgreSQL")
-		}
-	} else {
-		s.logger.Info("PostgreSQL repository not available, skipping database save")
+	if err := s.runProcess(ctx, "", "", s.pythonPath, args, s.options.Limits.MaxRuntime); err != nil {
+		s.logger.Errorf("%v", err)
+		return err
 	}
 
-	s.logger.Info("Data processing completed successfully")
+	s.logger.Info("Python data processing completed successfully")
 	return nil
 }
 
-// runPythonProcessor runs the Python data processing script
-func (s *DataProcessorService) runPythonProcessor(inputFile string) error {
-	outputDir := s.fileRepo.GetProcessedDataPath()
+// runProcess runs an external processor in its own process group under maxRuntime and the resource limits.
+// name labels the processor in errors, empty for the built-in Python script; dir is its working directory.
+// A failed run is reported as a *ProcessorError.
+func (s *DataProcessorService) runProcess(ctx context.Context, name string, dir string, command string, args []string, maxRuntime time.Duration) error {
+	limits := s.options.Limits
+	runCtx := ctx
+	if maxRuntime > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, maxRuntime)
+		defer cancel()
+	}
 
-	s.logger.Infof("Running Python data processor with input: %s, output: %s", inputFile, outputDir)
+	label := "Python script"
+	if name != "" {
+		label = "processor " + name
+	}
+	command, args, err := limitedCommand(command, args, limits)
+	if err != nil {
+		s.logger.Warnf("Failed to apply resource limits to the %s: %v", label, err)
+	}
 
-	// Prepare command
-	cmd := exec.Command(
-		s.pythonPath,
-		s.scriptPath,
-		"--input", inputFile,
-		"--output", outputDir,
-		"--cutoff", s.cutoffDate,
-	)
+	cmd := exec.CommandContext(runCtx, command, args...)
+	cmd.Dir = dir
+	setProcessGroup(cmd)
+	cmd.WaitDelay = processWaitDelay
 
 	// Set up pipes for stdout and stderr
 	stdout, err := cmd.StdoutPipe()
@@ -127,75 +171,172 @@ func (s *DataProcessorService) runPythonProcessor(inputFile string) error {
 	}
 
 	// Start command
+	started := time.Now()
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start Python script: %w", err)
+		return fmt.Errorf("failed to start %s: %w", label, err)
 	}
 
 	// Read stdout and stderr
+	var readers sync.WaitGroup
+	var memoryError atomic.Bool
+	readers.Add(2)
 	go func() {
-		buf := make([]byte, 1024)
-		for {
-			n, err := stdout.Read(buf)
-			if n > 0 {
-				s.logger.Info(string(buf[:n]))
-			}
-			if err != nil {
-				break
-			}
-		}
+		defer readers.Done()
+		readLines(stdout, func(line string) {
+			s.logger.Info(line)
+		})
 	}()
 
 	go func() {
-		buf := make([]byte, 1024)
-		for {
-			n, err := stderr.Read(buf)
-			if n > 0 {
-				s.logger.Warn(string(buf[:n]))
-			}
-			if err != nil {
-				break
+		defer readers.Done()
+		readLines(stderr, func(line string) {
+			s.logger.Warn(line)
+			if strings.Contains(line, "MemoryError") {
+				memoryError.Store(true)
 			}
-		}
+		})
 	}()
 
-	// Wait for command to finish
-	if err := cmd.Wait(); err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			s.logger.Errorf("Python script exited with code %d", exitErr.ExitCode())
+	// Wait for command to finish, Wait closes the pipes so the readers end as well
+	err = cmd.Wait()
+	readers.Wait()
+	if err != nil {
+		processorErr := &ProcessorError{
+			Processor: name,
+			Reason:    TerminationExit,
+			ExitCode:  cmd.ProcessState.ExitCode(),
+			Signal:    terminationSignal(cmd.ProcessState),
+			Runtime:   time.Since(started),
+			Err:       err,
+		}
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			processorErr.Reason = TerminationCancelled
+		case ctx.Err() != nil || runCtx.Err() != nil:
+			processorErr.Reason = TerminationTimeout
+		case processorErr.Signal == "SIGXCPU" || (processorErr.Signal == "SIGKILL" && limits.MaxCPUSeconds > 0 && cmd.ProcessState != nil &&
+			cmd.ProcessState.UserTime()+cmd.ProcessState.SystemTime() >= time.Duration(limits.MaxCPUSeconds)*time.Second):
+			processorErr.Reason = TerminationCPULimit
+		case processorErr.Signal != "":
+			processorErr.Reason = TerminationSignal
+		case memoryError.Load() && limits.MaxAddressSpaceMB > 0:
+			processorErr.Reason = TerminationMemoryLimit
+		}
+		return processorErr
+	}
+
+	return nil
+}
+
+// maxOutputLine bounds a line of processor output passed on by readLines, the rest of a longer line is dropped
+const maxOutputLine = 64 * 1024
+
+// readLines calls fn for every line read from r until it ends, so that a match is not split between reads
+func readLines(r io.Reader, fn func(line string)) {
+	reader := bufio.NewReader(r)
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if len(line) < maxOutputLine {
+			line = append(line, chunk[:min(len(chunk), maxOutputLine-len(line))]...)
+		}
+		if err != nil {
+			if len(line) > 0 {
+				fn(string(line))
+			}
+			return
+		}
+		if !isPrefix {
+			fn(string(line))
+			line = line[:0]
 		}
-		return fmt.Errorf("Python script failed: %w", err)
 	}
+}
+
+// runPythonWorker processes the archived raw data in the long-lived Python worker.
+// The batch is sent with the request, the worker answers with the saved split files.
+func (s *DataProcessorService) runPythonWorker(ctx context.Context, runID string, inputFile string, ratesFile string) error {
+	s.logger.Infof("Sending %s to the Python worker, output: %s", inputFile, s.fileRepo.GetProcessedDataPath())
 
-	// Check if processed data files exist
-	processedDataFile := filepath.Join(outputDir, "train_data.csv")
-	if _, err := os.Stat(processedDataFile); os.IsNotExist(err) {
-		return fmt.Errorf("processed data file not created: %s", processedDataFile)
+	args, err := s.processorArgs(runID, inputFile, ratesFile)
+	if err != nil {
+		return err
 	}
 
-	s.logger.Info("Python data processing completed successfully")
+	var records []map[string]interface{}
+	if err := s.fileRepo.LoadJSON(inputFile, &records); err != nil {
+		return fmt.Errorf("failed to load raw data: %w", err)
+	}
+
+	runCtx := ctx
+	if s.options.Limits.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, s.options.Limits.MaxRuntime)
+		defer cancel()
+	}
+
+	result, err := s.worker.Process(runCtx, args, records, func(progress WorkerProgress) {
+		if progress.Rows != nil {
+			s.logger.Infof("Python worker: %s (%d rows)", progress.Step, *progress.Rows)
+		} else {
+			s.logger.Infof("Python worker: %s", progress.Step)
+		}
+	})
+	if err != nil {
+		s.logger.Errorf("%v", err)
+		return err
+	}
+
+	s.logger.Infof("Python worker completed, split rows: %v", result.Rows)
 	return nil
 }
 
-// saveProcessedDataToPostgres saves train and test data to PostgreSQL
-func (s *DataProcessorService) saveProcessedDataToPostgres() error {
+// processorArgs saves the feature spec for the processor and builds its command line flags
+func (s *DataProcessorService) processorArgs(runID string, inputFile string, ratesFile string) ([]string, error) {
 	outputDir := s.fileRepo.GetProcessedDataPath()
 
-	// Save training data to PostgreSQL
-	trainDataFile := filepath.Join(outputDir, "train_data.csv")
-	if err := s.postgresRepo.SaveProcessedData(trainDataFile, "train"); err != nil {
-		return fmt.Errorf("failed to save training data to PostgreSQL: %w", err)
+	// Hand the validated feature spec to the processor and keep it with the dataset
+	specFile := filepath.Join(outputDir, "feature_spec.json")
+	if err := s.fileRepo.SaveJSON(s.featureSpec, specFile); err != nil {
+		return nil, fmt.Errorf("failed to save feature spec: %w", err)
+	}
+
+	args := append([]string{"--input", inputFile, "--output", outputDir, "--spec", specFile, "--run-id", runID}, s.options.args()...)
+	if ratesFile != "" {
+		args = append(args, "--exchange-rates", ratesFile)
 	}
-	s.logger.Info("Saved training data to PostgreSQL")
+	return args, nil
+}
 
-	// Save test data to PostgreSQL if it exists
-	testDataFile := filepath.Join(outputDir, "test_data.csv")
-	if _, err := os.Stat(testDataFile); err == nil {
-		if err := s.postgresRepo.SaveProcessedData(testDataFile, "test"); err != nil {
-			return fmt.Errorf("failed to save test data to PostgreSQL: %w", err)
+// saveProcessedDataToPostgres saves train, validation and test data to PostgreSQL
+func (s *DataProcessorService) saveProcessedDataToPostgres(runID string) error {
+	outputDir := s.fileRepo.GetProcessedDataPath()
+
+	// Training data is required, validation and test data are saved if they exist
+	files := []repository.ProcessedFile{{DataType: "train", Path: filepath.Join(outputDir, "train_data.csv")}}
+	for _, dataType := range []string{"validation", "test"} {
+		dataFile := filepath.Join(outputDir, dataType+"_data.csv")
+		if _, err := os.Stat(dataFile); err != nil {
+			s.logger.Infof("No %s data file found, skipping saving to PostgreSQL", dataType)
+			continue
 		}
-		s.logger.Info("Saved test data to PostgreSQL")
-	} else {
-		s.logger.Info("No test data file found, skipping saving to PostgreSQL")
+		files = append(files, repository.ProcessedFile{DataType: dataType, Path: dataFile})
+	}
+
+	// All splits are saved together so rows moving between splits or dropped by the run are closed
+	if err := s.postgresRepo.SaveProcessedData(files, s.featureSpec, runID); err != nil {
+		return fmt.Errorf("failed to save processed data to PostgreSQL: %w", err)
+	}
+	s.logger.Infof("Saved %d processed data files to PostgreSQL", len(files))
+
+	// Save the encoders fitted for this run
+	if err := s.saveEncodingArtifacts(runID); err != nil {
+		return fmt.Errorf("failed to save encoding artifacts to PostgreSQL: %w", err)
+	}
+
+	// Save the scaler parameters fitted for this run
+	if err := s.saveScalerParams(runID); err != nil {
+		return fmt.Errorf("failed to save scaler params to PostgreSQL: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Dataset ready event identity. DatasetEventVersion is increased on incompatible changes of the payload.
+const (
+	DatasetEventType    = "dataset_ready"
+	DatasetEventVersion = 1
+)
+
+// DatasetReadyEvent announces a dataset loaded by a successful run
+type DatasetReadyEvent struct {
+	EventType    string          `json:"event_type"`
+	EventVersion int             `json:"event_version"`
+	Pipeline     string          `json:"pipeline"`
+	RunID        string          `json:"run_id"`
+	PublishedAt  time.Time       `json:"published_at"`
+	Location     DatasetLocation `json:"location"`
+	RowCounts    map[string]int  `json:"row_counts"`
+	DateRange    DateRange       `json:"date_range"`
+	// CutoffDate is the train/test boundary of the cutoff split strategy
+	CutoffDate    string `json:"cutoff_date"`
+	SplitStrategy string `json:"split_strategy"`
+	// SchemaVersion is the version of the feature spec the dataset was built with
+	SchemaVersion int `json:"schema_version"`
+}
+
+// DatasetLocation tells where the dataset of a run can be read from
+type DatasetLocation struct {
+	// Files maps each split to its CSV file
+	Files        map[string]string `json:"files"`
+	ArtifactsDir string            `json:"artifacts_dir"`
+	// Table is the PostgreSQL table with the rows of the run, empty when the data was not loaded
+	Table string `json:"table,omitempty"`
+}
+
+// DateRange is the first and last date of the dataset
+type DateRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// publishDatasetReady publishes the dataset ready event of a run with publisher confirms
+func (s *DataProcessorService) publishDatasetReady(ctx context.Context, runID string) error {
+	if !s.datasetEvents.Enabled {
+		return nil
+	}
+
+	event, err := s.buildDatasetReadyEvent(runID)
+	if err != nil {
+		return fmt.Errorf("failed to build dataset ready event: %w", err)
+	}
+
+	eventID := fmt.Sprintf("%s:%s", DatasetEventType, runID)
+	if err := s.rabbitRepo.PublishEvent(ctx, s.datasetEvents.Exchange, s.datasetEvents.RoutingKey, DatasetEventType, eventID, event); err != nil {
+		return err
+	}
+
+	s.logger.Infof("Published dataset ready event for run %s (%d training rows)", runID, event.RowCounts["train"])
+	return nil
+}
+
+// buildDatasetReadyEvent describes the dataset of a run from its validation report
+func (s *DataProcessorService) buildDatasetReadyEvent(runID string) (*DatasetReadyEvent, error) {
+	var report validationReport
+	if err := s.fileRepo.LoadJSON(s.runFile(runID, validationReportFile), &report); err != nil {
+		return nil, fmt.Errorf("failed to load validation report: %w", err)
+	}
+
+	processedPath := s.fileRepo.GetProcessedDataPath()
+	event := &DatasetReadyEvent{
+		EventType:    DatasetEventType,
+		EventVersion: DatasetEventVersion,
+		Pipeline:     s.datasetEvents.Pipeline,
+		RunID:        runID,
+		PublishedAt:  time.Now().UTC(),
+		Location: DatasetLocation{
+			Files:        make(map[string]string, len(report)),
+			ArtifactsDir: filepath.Join(processedPath, "artifacts", runID),
+		},
+		RowCounts:     make(map[string]int, len(report)),
+		CutoffDate:    s.options.CutoffDate,
+		SplitStrategy: s.options.Split.Strategy,
+		SchemaVersion: s.featureSpec.Version,
+	}
+	if s.postgresRepo != nil {
+		event.Location.Table = "processed_data"
+	}
+
+	for split, summary := range report {
+		event.Location.Files[split] = filepath.Join(processedPath, split+"_data.csv")
+		event.RowCounts[split] = summary.Rows
+		if summary.DateFrom != "" && (event.DateRange.From == "" || summary.DateFrom < event.DateRange.From) {
+			event.DateRange.From = summary.DateFrom
+		}
+		if summary.DateTo > event.DateRange.To {
+			event.DateRange.To = summary.DateTo
+		}
+	}
+
+	return event, nil
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrDatabaseUnavailable is returned by operations that need PostgreSQL when it is not connected
+var ErrDatabaseUnavailable = errors.New("PostgreSQL repository is not available")
+
+// ExportDatasetAsOf writes the processed dataset as it was known at asOf to w as CSV,
+// so that backtests do not see rows restated after that time. An empty dataType exports
+// every split. It returns the number of exported rows.
+func (s *DataProcessorService) ExportDatasetAsOf(w io.Writer, asOf time.Time, dataType string) (int, error) {
+	if s.postgresRepo == nil {
+		return 0, ErrDatabaseUnavailable
+	}
+
+	count, err := s.postgresRepo.ExportProcessedDataAsOf(w, asOf, dataType, s.featureSpec)
+	if err != nil {
+		return count, fmt.Errorf("failed to export dataset: %w", err)
+	}
+
+	s.logger.Infof("Exported %d rows of %q data as of %s", count, dataType, asOf.Format(time.RFC3339))
+	return count, nil
+}
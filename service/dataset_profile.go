@@ -0,0 +1,81 @@
+package service
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// datasetProfile mirrors the profile.json report written by the Python script
+type datasetProfile struct {
+	GeneratedAt  string                   `json:"generated_at"`
+	RowCount     int                      `json:"row_count"`
+	ColumnCount  int                      `json:"column_count"`
+	Columns      map[string]columnProfile `json:"columns"`
+	DateCoverage []productDateCoverage    `json:"date_coverage"`
+}
+
+// columnProfile holds per-column statistics of the processed dataset
+type columnProfile struct {
+	Kind     string  `json:"kind"`
+	Count    int     `json:"count"`
+	NullRate float64 `json:"null_rate"`
+}
+
+// productDateCoverage describes how many calendar days are present for a product
+type productDateCoverage struct {
+	ProductID    string  `json:"product_id"`
+	ProductName  string  `json:"product_name"`
+	ObservedDays int     `json:"observed_days"`
+	ExpectedDays int     `json:"expected_days"`
+	Coverage     float64 `json:"coverage"`
+}
+
+// maxLoggedNullColumns limits the number of columns listed in the null rate summary
+const maxLoggedNullColumns = 5
+
+// logDatasetProfile reads the dataset profile and writes a short summary to the run logs
+func (s *DataProcessorService) logDatasetProfile() {
+	profilePath := filepath.Join(s.fileRepo.GetProcessedDataPath(), "profile.json")
+
+	var profile datasetProfile
+	if err := s.fileRepo.LoadJSON(profilePath, &profile); err != nil {
+		s.logger.Warnf("Failed to load dataset profile: %v", err)
+		return
+	}
+
+	s.logger.Infof("Dataset profile: %d rows, %d columns, %d products (report: %s)",
+		profile.RowCount, profile.ColumnCount, len(profile.DateCoverage), profilePath)
+
+	// Columns with the highest share of missing values
+	names := make([]string, 0, len(profile.Columns))
+	for name, col := range profile.Columns {
+		if col.NullRate > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return profile.Columns[names[i]].NullRate > profile.Columns[names[j]].NullRate
+	})
+	if len(names) > maxLoggedNullColumns {
+		names = names[:maxLoggedNullColumns]
+	}
+	for _, name := range names {
+		s.logger.Infof("Column %s: null rate %.2f%%", name, profile.Columns[name].NullRate*100)
+	}
+
+	// Date coverage across products
+	if len(profile.DateCoverage) > 0 {
+		minCoverage := profile.DateCoverage[0]
+		totalCoverage := 0.0
+		for _, c := range profile.DateCoverage {
+			totalCoverage += c.Coverage
+			if c.Coverage < minCoverage.Coverage {
+				minCoverage = c
+			}
+		}
+		s.logger.Infof("Date coverage: mean %.2f%%, lowest %.2f%% (%s %q, %d of %d days)",
+			totalCoverage/float64(len(profile.DateCoverage))*100,
+			minCoverage.Coverage*100, minCoverage.ProductID, minCoverage.ProductName,
+			minCoverage.ObservedDays, minCoverage.ExpectedDays)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// encodersFilePath returns the versioned encoders file of a run
+func (s *DataProcessorService) encodersFilePath(runID string) string {
+	return filepath.Join(s.fileRepo.GetProcessedDataPath(), "artifacts", runID, "encoders.json")
+}
+
+// saveEncodingArtifacts stores the encoders fitted by the Python script in PostgreSQL
+func (s *DataProcessorService) saveEncodingArtifacts(runID string) error {
+	if s.featureSpec.Encoding == nil || len(s.featureSpec.Encoding.Columns) == 0 {
+		return nil
+	}
+
+	var artifacts repository.EncodingArtifacts
+	if err := s.fileRepo.LoadJSON(s.encodersFilePath(runID), &artifacts); err != nil {
+		return err
+	}
+
+	return s.postgresRepo.SaveEncodingArtifacts(&artifacts)
+}
+
+// GetEncoders returns the encoders fitted during a run, or during the latest run when runID is empty.
+// PostgreSQL is queried first, the artifact files are used when the database is not available.
+func (s *DataProcessorService) GetEncoders(runID string) (*repository.EncodingArtifacts, error) {
+	// The run ID becomes part of the artifact path
+	if runID != "" && !runIDPattern.MatchString(runID) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidRunID, runID)
+	}
+
+	if s.postgresRepo != nil {
+		artifacts, err := s.postgresRepo.GetEncodingArtifacts(runID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load encoders: %w", err)
+		}
+		if artifacts != nil {
+			return artifacts, nil
+		}
+	}
+
+	// The latest run's encoders are also kept next to train_data.csv
+	filePath := filepath.Join(s.fileRepo.GetProcessedDataPath(), "encoders.json")
+	if runID != "" {
+		filePath = s.encodersFilePath(runID)
+	}
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no encoders found for run %q", runID)
+	}
+
+	var artifacts repository.EncodingArtifacts
+	if err := s.fileRepo.LoadJSON(filePath, &artifacts); err != nil {
+		return nil, fmt.Errorf("failed to load encoders: %w", err)
+	}
+	return &artifacts, nil
+}
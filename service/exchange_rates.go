@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// prepareExchangeRates collects the known exchange rates and writes them next to the raw data.
+// It returns an empty path when no rates are available.
+func (s *DataProcessorService) prepareExchangeRates(ctx context.Context, timestamp string) (string, error) {
+	var rates []repository.ExchangeRate
+
+	if s.exchangeRateRepo.Configured() {
+		loaded, err := s.exchangeRateRepo.LoadRates(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to load exchange rates: %w", err)
+		}
+		rates = loaded
+	}
+
+	// Keep the rate history in PostgreSQL so earlier dates can still be converted
+	if s.postgresRepo != nil {
+		if len(rates) > 0 {
+			if err := s.postgresRepo.SaveExchangeRates(rates, s.options.BaseCurrency); err != nil {
+				s.logger.Warnf("Failed to save exchange rates to PostgreSQL: %v", err)
+			}
+		}
+
+		stored, err := s.postgresRepo.GetExchangeRates(s.options.BaseCurrency)
+		if err != nil {
+			s.logger.Warnf("Failed to load exchange rates from PostgreSQL: %v", err)
+		} else if len(stored) > 0 {
+			rates = stored
+		}
+	}
+
+	if len(rates) == 0 {
+		s.logger.Infof("No exchange rates available, only %s prices will be processed", s.options.BaseCurrency)
+		return "", nil
+	}
+
+	ratesFilePath := filepath.Join(s.fileRepo.GetRawDataPath(), fmt.Sprintf("exchange_rates_%s.csv", timestamp))
+	if err := s.fileRepo.SaveExchangeRates(rates, ratesFilePath); err != nil {
+		return "", fmt.Errorf("failed to save exchange rates: %w", err)
+	}
+
+	s.logger.Infof("Saved %d exchange rates to %s", len(rates), ratesFilePath)
+	return ratesFilePath, nil
+}
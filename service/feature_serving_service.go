@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/featurespec"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// FeatureCacheStatus describes the contents of the feature cache
+type FeatureCacheStatus struct {
+	Series      int       `json:"series"`
+	RunID       string    `json:"run_id,omitempty"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+// FeatureServingService serves the latest feature vectors of product series from an in-memory cache
+type FeatureServingService struct {
+	fileRepo     *repository.FileRepository
+	postgresRepo *repository.PostgresRepository
+	featureSpec  *featurespec.Spec
+	logger       *zap.SugaredLogger
+
+	mu      sync.RWMutex
+	vectors map[repository.FeatureKey]repository.FeatureVector
+	status  FeatureCacheStatus
+}
+
+// NewFeatureServingService creates a new FeatureServingService instance
+func NewFeatureServingService(
+	fileRepo *repository.FileRepository,
+	postgresRepo *repository.PostgresRepository,
+	featureSpec *featurespec.Spec,
+	logger *zap.SugaredLogger,
+) *FeatureServingService {
+	return &FeatureServingService{
+		fileRepo:     fileRepo,
+		postgresRepo: postgresRepo,
+		featureSpec:  featureSpec,
+		logger:       logger,
+		vectors:      make(map[repository.FeatureKey]repository.FeatureVector),
+	}
+}
+
+// Refresh reloads the latest feature vectors from PostgreSQL, or from the processed files
+// when the database is not available
+func (s *FeatureServingService) Refresh(runID string) error {
+	var vectors []repository.FeatureVector
+	var err error
+	if s.postgresRepo != nil {
+		vectors, err = s.postgresRepo.GetLatestFeatureVectors(s.featureSpec)
+	} else {
+		processedPath := s.fileRepo.GetProcessedDataPath()
+		vectors, err = s.fileRepo.LoadLatestFeatureVectors([]string{
+			filepath.Join(processedPath, "train_data.csv"),
+			filepath.Join(processedPath, "validation_data.csv"),
+			filepath.Join(processedPath, "test_data.csv"),
+		}, s.featureSpec)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load feature vectors: %w", err)
+	}
+
+	cache := make(map[repository.FeatureKey]repository.FeatureVector, len(vectors))
+	for _, vector := range vectors {
+		cache[vector.Key()] = vector
+	}
+
+	s.mu.Lock()
+	s.vectors = cache
+	s.status = FeatureCacheStatus{Series: len(cache), RunID: runID, RefreshedAt: time.Now()}
+	s.mu.Unlock()
+
+	s.logger.Infof("Feature cache refreshed with %d series", len(cache))
+	return nil
+}
+
+// GetFeatures returns the cached feature vectors of the given keys and the keys that are not known
+func (s *FeatureServingService) GetFeatures(keys []repository.FeatureKey) ([]repository.FeatureVector, []repository.FeatureKey) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vectors := make([]repository.FeatureVector, 0, len(keys))
+	var missing []repository.FeatureKey
+	for _, key := range keys {
+		if vector, ok := s.vectors[key]; ok {
+			vectors = append(vectors, vector)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+
+	return vectors, missing
+}
+
+// Status returns the current state of the feature cache
+func (s *FeatureServingService) Status() FeatureCacheStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
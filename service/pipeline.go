@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/config"
+)
+
+// Run and stage statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusAbandoned = "abandoned"
+	// StatusSkipped is a chained processor that had nothing to change
+	StatusSkipped = "skipped"
+)
+
+// runStateFile is the name of the state file in a run directory
+const runStateFile = "state.json"
+
+// runIDPattern matches run IDs, which are run start timestamps in milliseconds.
+// IDs of runs started before milliseconds were added have no _mmm suffix.
+var runIDPattern = regexp.MustCompile(`^\d{8}_\d{6}(_\d{3})?$`)
+
+// errNoNewData ends a run whose consume stage found no messages
+var errNoNewData = errors.New("no new data to process")
+
+// ErrRunNotFound is returned for unknown pipeline runs
+var ErrRunNotFound = errors.New("run not found")
+
+// ErrInvalidRunID is returned for run IDs that do not match runIDPattern
+var ErrInvalidRunID = errors.New("invalid run ID")
+
+// RunState is the persisted progress of a pipeline run
+type RunState struct {
+	RunID     string       `json:"run_id"`
+	Status    string       `json:"status"`
+	Resumes   int          `json:"resumes"`
+	StartedAt time.Time    `json:"started_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Stages    []StageState `json:"stages"`
+}
+
+// StageState is the progress of a single stage of a run
+type StageState struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	// TerminationReason tells why the external processor of the stage stopped, see ProcessorError
+	TerminationReason string `json:"termination_reason,omitempty"`
+	// Outputs are the files the stage saved for the following stages
+	Outputs []string `json:"outputs,omitempty"`
+	// Steps are the processors run by the stage, in order
+	Steps []StepState `json:"steps,omitempty"`
+}
+
+// StepState is the timing and result of one processor run by a stage
+type StepState struct {
+	Name            string    `json:"name"`
+	Version         int       `json:"version,omitempty"`
+	Status          string    `json:"status"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Error           string    `json:"error,omitempty"`
+	// Rows are the row counts of the splits the processor wrote
+	Rows map[string]int `json:"rows,omitempty"`
+}
+
+// stageFunc runs a stage of the run and returns the files it saved
+type stageFunc func(ctx context.Context, run *RunState) ([]string, error)
+
+// stageFuncs maps the pipeline stages to their implementations
+func (s *DataProcessorService) stageFuncs() map[string]stageFunc {
+	return map[string]stageFunc{
+		"consume":   s.consumeStage,
+		"archive":   s.archiveStage,
+		"transform": s.transformStage,
+		"validate":  s.validateStage,
+		"load":      s.loadStage,
+		"publish":   s.publishStage,
+	}
+}
+
+// newRun creates the state of a new run with all stages pending
+func (s *DataProcessorService) newRun() *RunState {
+	now := time.Now()
+	runID := formatRunID(now)
+	// Never reuse the directory of an earlier run started within the same millisecond
+	for s.fileRepo.RunExists(runID) {
+		now = now.Add(time.Millisecond)
+		runID = formatRunID(now)
+	}
+
+	run := &RunState{
+		RunID:     runID,
+		Status:    StatusPending,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	for _, name := range config.PipelineStages {
+		run.Stages = append(run.Stages, StageState{Name: name, Status: StatusPending})
+	}
+	return run
+}
+
+// formatRunID returns the run ID of a run started at the given time, YYYYMMDD_HHMMSS_mmm
+func formatRunID(t time.Time) string {
+	return fmt.Sprintf("%s_%03d", t.Format("20060102_150405"), t.Nanosecond()/int(time.Millisecond))
+}
+
+// executeRun runs the stages of a run that have not completed yet, in order
+func (s *DataProcessorService) executeRun(ctx context.Context, run *RunState) error {
+	funcs := s.stageFuncs()
+
+	run.Status = StatusRunning
+	for i := range run.Stages {
+		stage := &run.Stages[i]
+		if stage.Status == StatusCompleted {
+			continue
+		}
+
+		if err := s.runStage(ctx, run, stage, funcs[stage.Name]); err != nil {
+			run.Status = StatusFailed
+			s.saveRunState(run)
+			return fmt.Errorf("stage %s of run %s failed: %w", stage.Name, run.RunID, err)
+		}
+	}
+
+	run.Status = StatusCompleted
+	s.saveRunState(run)
+	return nil
+}
+
+// runStage runs a stage under its timeout and retries it with exponential backoff
+func (s *DataProcessorService) runStage(ctx context.Context, run *RunState, stage *StageState, fn stageFunc) error {
+	policy := s.pipeline.Stages[stage.Name]
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("run cancelled: %w", err)
+		}
+
+		started := time.Now()
+		stage.Status = StatusRunning
+		stage.Attempts++
+		stage.StartedAt = &started
+		stage.FinishedAt = nil
+		stage.Error = ""
+		stage.TerminationReason = ""
+		stage.Steps = nil
+		s.saveRunState(run)
+
+		stageCtx, cancel := context.WithTimeout(ctx, policy.Timeout)
+		outputs, err := fn(stageCtx, run)
+		cancel()
+
+		finished := time.Now()
+		stage.FinishedAt = &finished
+		if err == nil {
+			stage.Status = StatusCompleted
+			stage.Outputs = outputs
+			s.saveRunState(run)
+			s.logger.Infof("Stage %s of run %s completed in %s", stage.Name, run.RunID, finished.Sub(started).Round(time.Millisecond))
+			return nil
+		}
+
+		stage.Status = StatusFailed
+		stage.Error = err.Error()
+		var processorErr *ProcessorError
+		if errors.As(err, &processorErr) {
+			stage.TerminationReason = processorErr.Reason
+		}
+		s.saveRunState(run)
+
+		if errors.Is(err, errNoNewData) || attempt >= policy.Attempts || ctx.Err() != nil {
+			return err
+		}
+		if processorErr != nil && !processorErr.Retryable() {
+			s.logger.Warnf("Stage %s of run %s is not retried: %v", stage.Name, run.RunID, err)
+			return err
+		}
+
+		delay := retryDelay(policy, attempt)
+		s.logger.Warnf("Stage %s of run %s failed (attempt %d of %d), retrying in %s: %v",
+			stage.Name, run.RunID, attempt, policy.Attempts, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("run cancelled: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runStep runs a processor of a stage and records its timing in the run state.
+// fn may mark the step skipped and set its row counts.
+func (s *DataProcessorService) runStep(run *RunState, stage *StageState, name string, version int, fn func(step *StepState) error) error {
+	stage.Steps = append(stage.Steps, StepState{Name: name, Version: version, Status: StatusRunning, StartedAt: time.Now()})
+	s.saveRunState(run)
+
+	step := &stage.Steps[len(stage.Steps)-1]
+	err := fn(step)
+	step.FinishedAt = time.Now()
+	step.DurationSeconds = step.FinishedAt.Sub(step.StartedAt).Seconds()
+	switch {
+	case err != nil:
+		step.Status = StatusFailed
+		step.Error = err.Error()
+	case step.Status == StatusRunning:
+		step.Status = StatusCompleted
+	}
+	s.saveRunState(run)
+
+	if err == nil {
+		s.logger.Infof("Processor %s %s in %s", name, step.Status, step.FinishedAt.Sub(step.StartedAt).Round(time.Millisecond))
+	}
+	return err
+}
+
+// retryDelay returns the backoff before the retry following the given attempt
+func retryDelay(policy config.StagePolicy, attempt int) time.Duration {
+	delay := policy.Backoff
+	for i := 1; i < attempt && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+	return delay
+}
+
+// resumeUnfinishedRuns resumes failed and interrupted runs from their first incomplete stage, oldest first.
+// A run that fails again stops the others, so batches are loaded in order; it is abandoned
+// after ResumeAttempts resumes, which lets the following runs go on.
+func (s *DataProcessorService) resumeUnfinishedRuns(ctx context.Context) error {
+	runIDs, err := s.fileRepo.ListRuns()
+	if err != nil {
+		return fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	for _, runID := range runIDs {
+		run, err := s.GetRunState(runID)
+		if err != nil {
+			s.logger.Warnf("Skipping run %s: %v", runID, err)
+			continue
+		}
+		if run.Status != StatusFailed && run.Status != StatusRunning {
+			continue
+		}
+
+		if run.Resumes >= s.pipeline.ResumeAttempts {
+			run.Status = StatusAbandoned
+			s.saveRunState(run)
+			s.logger.Errorf("Abandoned run %s after %d resumes, its files are kept in %s",
+				run.RunID, run.Resumes, s.fileRepo.GetRunPath(run.RunID))
+			continue
+		}
+
+		// The resume counts even if the run stops before its first stage saves the state
+		run.Resumes++
+		s.saveRunState(run)
+		s.logger.Infof("Resuming run %s from stage %s (resume %d)", run.RunID, firstIncompleteStage(run), run.Resumes)
+		if err := s.executeRun(ctx, run); err != nil {
+			return err
+		}
+		s.logger.Infof("Resumed run %s completed", run.RunID)
+	}
+
+	return nil
+}
+
+// stage returns the state of the named stage of the run
+func (r *RunState) stage(name string) *StageState {
+	for i := range r.Stages {
+		if r.Stages[i].Name == name {
+			return &r.Stages[i]
+		}
+	}
+	return nil
+}
+
+// firstIncompleteStage returns the name of the stage a run continues from
+func firstIncompleteStage(run *RunState) string {
+	for _, stage := range run.Stages {
+		if stage.Status != StatusCompleted {
+			return stage.Name
+		}
+	}
+	return ""
+}
+
+// GetRunState returns the persisted state of a pipeline run
+func (s *DataProcessorService) GetRunState(runID string) (*RunState, error) {
+	if !runIDPattern.MatchString(runID) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidRunID, runID)
+	}
+
+	var run RunState
+	if err := s.fileRepo.LoadJSON(s.runFile(runID, runStateFile), &run); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+	}
+	return &run, nil
+}
+
+// saveRunState persists the state of a run, a failure is only logged to keep the run going
+func (s *DataProcessorService) saveRunState(run *RunState) {
+	run.UpdatedAt = time.Now()
+	if err := s.fileRepo.SaveJSON(run, s.runFile(run.RunID, runStateFile)); err != nil {
+		s.logger.Warnf("Failed to save state of run %s: %v", run.RunID, err)
+	}
+}
+
+// runFile returns the path of a file in the run directory
+func (s *DataProcessorService) runFile(runID string, name string) string {
+	return filepath.Join(s.fileRepo.GetRunPath(runID), name)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// validationReportFile is the name of the validate stage's report in the run directory
+const validationReportFile = "validation.json"
+
+// validationReport maps each processed split to its row count and date range
+type validationReport map[string]*repository.CSVSummary
+
+// requiredProcessedColumns must be present in every processed split
+var requiredProcessedColumns = []string{"product_id", "product_name", "region", "date", "sales_quantity"}
+
+// consumeStage reads a batch from RabbitMQ and saves it to the run directory.
+// Messages are acknowledged once the batch is on disk, so a failed run resumes without refetching.
+func (s *DataProcessorService) consumeStage(ctx context.Context, run *RunState) ([]string, error) {
+	batch, err := s.rabbitRepo.ConsumeMessages(ctx, s.batchSize, s.consumeTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume messages: %w", err)
+	}
+
+	if len(batch.Data) == 0 {
+		return nil, errNoNewData
+	}
+
+	s.logger.Infof("Consumed %d messages from RabbitMQ", len(batch.Data))
+
+	consumedFile := s.runFile(run.RunID, "consumed.json")
+	if err := s.fileRepo.SaveMarketplaceData(batch.Data, consumedFile); err != nil {
+		batch.Nack()
+		return nil, fmt.Errorf("failed to save consumed data: %w", err)
+	}
+	batch.Ack()
+
+	return []string{consumedFile}, nil
+}
+
+// archiveStage resolves product identities and archives the consumed batch as raw data
+func (s *DataProcessorService) archiveStage(ctx context.Context, run *RunState) ([]string, error) {
+	var data []map[string]interface{}
+	if err := s.fileRepo.LoadJSON(s.runFile(run.RunID, "consumed.json"), &data); err != nil {
+		return nil, fmt.Errorf("failed to load consumed data: %w", err)
+	}
+
+	// Resolve canonical product identities before the data is archived
+	if err := s.assignProductIDs(data); err != nil {
+		return nil, fmt.Errorf("failed to assign product IDs: %w", err)
+	}
+
+	rawFilePath := s.rawFilePath(run.RunID)
+	if err := s.fileRepo.SaveMarketplaceData(data, rawFilePath); err != nil {
+		return nil, fmt.Errorf("failed to save raw data: %w", err)
+	}
+
+	s.logger.Infof("Saved raw data to %s", rawFilePath)
+	return []string{rawFilePath}, nil
+}
+
+// transformStage runs the Python processor on the archived raw data, in the worker when one is used,
+// followed by the chained processors. Every processor is timed as a step of the stage.
+func (s *DataProcessorService) transformStage(ctx context.Context, run *RunState) ([]string, error) {
+	// Prepare exchange rates for price normalization
+	ratesFilePath, err := s.prepareExchangeRates(ctx, run.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare exchange rates: %w", err)
+	}
+
+	process := s.runPythonProcessor
+	if s.worker != nil {
+		process = s.runPythonWorker
+	}
+	stage := run.stage("transform")
+	name := strings.TrimSuffix(filepath.Base(s.scriptPath), filepath.Ext(s.scriptPath))
+	err = s.runStep(run, stage, name, 0, func(step *StepState) error {
+		return process(ctx, run.RunID, s.rawFilePath(run.RunID), ratesFilePath)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to process data: %w", err)
+	}
+
+	if err := s.runProcessorChain(ctx, run, stage); err != nil {
+		return nil, err
+	}
+
+	return s.processedSplitFiles(), nil
+}
+
+// validateStage checks the processed splits before they are loaded
+func (s *DataProcessorService) validateStage(ctx context.Context, run *RunState) ([]string, error) {
+	required := append(append([]string(nil), requiredProcessedColumns...), s.featureSpec.FeatureColumns()...)
+
+	files := s.processedSplitFiles()
+	if len(files) == 0 || filepath.Base(files[0]) != "train_data.csv" {
+		return nil, fmt.Errorf("processed data file not created: train_data.csv")
+	}
+
+	report := make(validationReport, len(files))
+	for _, file := range files {
+		summary, err := s.fileRepo.InspectCSV(file, "date")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		columns := make(map[string]bool, len(summary.Header))
+		for _, col := range summary.Header {
+			columns[col] = true
+		}
+		for _, col := range required {
+			if !columns[col] {
+				return nil, fmt.Errorf("%s has no %s column", filepath.Base(file), col)
+			}
+		}
+
+		report[splitName(file)] = summary
+	}
+	if report["train"].Rows == 0 {
+		return nil, fmt.Errorf("training data is empty")
+	}
+
+	// Summarize the dataset profile produced by the Python script
+	s.logDatasetProfile()
+
+	reportFile := s.runFile(run.RunID, validationReportFile)
+	if err := s.fileRepo.SaveJSON(report, reportFile); err != nil {
+		return nil, fmt.Errorf("failed to save validation report: %w", err)
+	}
+
+	return []string{reportFile}, nil
+}
+
+// loadStage saves the processed data and the fitted artifacts to PostgreSQL
+func (s *DataProcessorService) loadStage(ctx context.Context, run *RunState) ([]string, error) {
+	if s.postgresRepo == nil {
+		s.logger.Info("PostgreSQL repository not available, skipping database save")
+		return nil, nil
+	}
+
+	if err := s.saveProcessedDataToPostgres(run.RunID); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Successfully saved processed data to PostgreSQL")
+	return nil, nil
+}
+
+// publishStage announces the new dataset to the ML service and notifies the run hooks
+func (s *DataProcessorService) publishStage(ctx context.Context, run *RunState) ([]string, error) {
+	if err := s.publishDatasetReady(ctx, run.RunID); err != nil {
+		return nil, err
+	}
+
+	for _, hook := range s.runHooks {
+		hook(run.RunID)
+	}
+	return nil, nil
+}
+
+// rawFilePath returns the path of the raw data archived by a run
+func (s *DataProcessorService) rawFilePath(runID string) string {
+	return filepath.Join(s.fileRepo.GetRawDataPath(), fmt.Sprintf("marketplace_data_%s.json", runID))
+}
+
+// splitName returns the split of a processed data file, e.g. train for train_data.csv
+func splitName(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), "_data.csv")
+}
+
+// processedSplitFiles returns the processed split files that exist, training data first
+func (s *DataProcessorService) processedSplitFiles() []string {
+	var files []string
+	for _, dataType := range []string{"train", "validation", "test"} {
+		file := filepath.Join(s.fileRepo.GetProcessedDataPath(), dataType+"_data.csv")
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
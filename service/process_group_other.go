@@ -0,0 +1,17 @@
+//go:build !unix
+
+package service
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup keeps the default cancellation, which kills only the direct child,
+// because process groups are not available on this platform
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminationSignal returns no signal, exit statuses carry no signal information on this platform
+func terminationSignal(state *os.ProcessState) string {
+	return ""
+}
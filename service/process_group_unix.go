@@ -0,0 +1,44 @@
+//go:build unix
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group and makes cancellation
+// kill the whole group, so processes spawned by the script do not outlive it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// signalNames are the names of the signals expected to terminate the processor
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGABRT: "SIGABRT",
+}
+
+// terminationSignal returns the name of the signal that terminated the process, if any
+func terminationSignal(state *os.ProcessState) string {
+	if state == nil {
+		return ""
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	if name, ok := signalNames[status.Signal()]; ok {
+		return name
+	}
+	return fmt.Sprintf("signal %d", int(status.Signal()))
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/graduate-work-mirea/data-processor-service/config"
+)
+
+// cpuLimitGrace is the time between SIGXCPU at the soft CPU limit and SIGKILL at the hard one
+const cpuLimitGrace = 5
+
+// limitedCommand wraps a command so that the address space and CPU time limits are set
+// by a shell in the child before it execs the command, which inherits them with its children.
+// Without limits the command is returned unchanged.
+func limitedCommand(command string, args []string, limits config.ProcessorLimits) (string, []string, error) {
+	var steps []string
+	if limits.MaxAddressSpaceMB > 0 {
+		// ulimit -v takes kilobytes
+		steps = append(steps, fmt.Sprintf("ulimit -v %d", limits.MaxAddressSpaceMB*1024))
+	}
+	if limits.MaxCPUSeconds > 0 {
+		// The soft limit goes first, a hard limit below the current soft one is rejected
+		steps = append(steps,
+			fmt.Sprintf("ulimit -S -t %d", limits.MaxCPUSeconds),
+			fmt.Sprintf("ulimit -H -t %d", limits.MaxCPUSeconds+cpuLimitGrace))
+	}
+	if len(steps) == 0 {
+		return command, args, nil
+	}
+
+	// The command and its arguments are passed as positional parameters, so they are not quoted
+	script := strings.Join(append(steps, `exec "$0" "$@"`), " && ")
+	return "/bin/sh", append([]string{"-c", script, command}, args...), nil
+}
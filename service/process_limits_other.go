@@ -0,0 +1,18 @@
+//go:build !linux
+
+package service
+
+import (
+	"errors"
+
+	"github.com/graduate-work-mirea/data-processor-service/config"
+)
+
+// limitedCommand returns the command unchanged and reports configured limits as unsupported,
+// resource limits are applied on Linux only
+func limitedCommand(command string, args []string, limits config.ProcessorLimits) (string, []string, error) {
+	if limits.MaxAddressSpaceMB > 0 || limits.MaxCPUSeconds > 0 {
+		return command, args, errors.New("resource limits are only supported on Linux")
+	}
+	return command, args, nil
+}
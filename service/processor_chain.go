@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/plugin"
+)
+
+// UseProcessors chains external processors after the built-in one, run in the given order
+func (s *DataProcessorService) UseProcessors(chain []*plugin.Manifest) {
+	s.processors = chain
+}
+
+// runProcessorChain runs the chained processors on the processed splits, each one's validated
+// outputs replacing the splits for the next one
+func (s *DataProcessorService) runProcessorChain(ctx context.Context, run *RunState, stage *StageState) error {
+	for _, processor := range s.processors {
+		err := s.runStep(run, stage, processor.Name, processor.Version, func(step *StepState) error {
+			return s.runChainedProcessor(ctx, run.RunID, processor, step)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runChainedProcessor runs one chained processor on the processed splits.
+// It reads <split>_data.csv files from --input-dir and writes the same files to --output-dir.
+func (s *DataProcessorService) runChainedProcessor(ctx context.Context, runID string, processor *plugin.Manifest, step *StepState) error {
+	inputs := s.processedSplitFiles()
+	for _, file := range inputs {
+		if _, err := processor.Input.ValidateCSV(file); err != nil {
+			return &ProcessorError{Processor: processor.Name, Reason: TerminationInvalidInput, Err: err}
+		}
+	}
+
+	// The processor runs in its manifest's directory, so it is given absolute paths
+	inputDir, err := filepath.Abs(s.fileRepo.GetProcessedDataPath())
+	if err != nil {
+		return fmt.Errorf("failed to resolve input directory of processor %s: %w", processor.Name, err)
+	}
+
+	// Outputs are written to the run directory and replace the splits only once they are valid
+	outputDir, err := filepath.Abs(s.runFile(runID, filepath.Join("steps", processor.Name)))
+	if err != nil {
+		return fmt.Errorf("failed to resolve output directory of processor %s: %w", processor.Name, err)
+	}
+	if err := os.RemoveAll(outputDir); err != nil {
+		return fmt.Errorf("failed to clean output directory of processor %s: %w", processor.Name, err)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory of processor %s: %w", processor.Name, err)
+	}
+
+	args := append(append([]string(nil), processor.Command[1:]...),
+		"--input-dir", inputDir,
+		"--output-dir", outputDir,
+		"--run-id", runID,
+	)
+	timeout := processor.Timeout()
+	if timeout == 0 {
+		timeout = s.options.Limits.MaxRuntime
+	}
+
+	s.logger.Infof("Running processor %s (version %d)", processor.Name, processor.Version)
+	err = s.runProcess(ctx, processor.Name, processor.Dir, processor.Executable(), args, timeout)
+	var processorErr *ProcessorError
+	if errors.As(err, &processorErr) && processorErr.Reason == TerminationExit {
+		switch processorErr.ExitCode {
+		case plugin.ExitSkipped:
+			step.Status = StatusSkipped
+			return nil
+		case plugin.ExitInvalidInput:
+			processorErr.Reason = TerminationInvalidInput
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	step.Rows = make(map[string]int, len(inputs))
+	for _, file := range inputs {
+		rows, err := processor.Output.ValidateCSV(filepath.Join(outputDir, filepath.Base(file)))
+		if err != nil {
+			return &ProcessorError{Processor: processor.Name, Reason: TerminationInvalidOutput, Err: err}
+		}
+		step.Rows[splitName(file)] = rows
+	}
+
+	for _, file := range inputs {
+		if err := os.Rename(filepath.Join(outputDir, filepath.Base(file)), file); err != nil {
+			return fmt.Errorf("failed to replace %s with the output of processor %s: %w", filepath.Base(file), processor.Name, err)
+		}
+	}
+
+	return nil
+}
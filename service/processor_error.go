@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reasons why the external processor terminated
+const (
+	// TerminationExit is a non-zero exit code of the processor itself
+	TerminationExit = "exit"
+	// TerminationTimeout is the maximum runtime or the stage timeout being exceeded
+	TerminationTimeout = "timeout"
+	// TerminationCancelled is the run being cancelled, e.g. on shutdown
+	TerminationCancelled = "cancelled"
+	// TerminationCPULimit is the CPU time resource limit being exceeded
+	TerminationCPULimit = "cpu_limit"
+	// TerminationMemoryLimit is an allocation failing under the address space resource limit
+	TerminationMemoryLimit = "memory_limit"
+	// TerminationSignal is a signal sent by someone else, e.g. the OOM killer
+	TerminationSignal = "signal"
+	// TerminationException is an exception raised while the Python worker processed a batch
+	TerminationException = "exception"
+	// TerminationInvalidInput is a chained processor rejecting its input, by exit code or input schema
+	TerminationInvalidInput = "invalid_input"
+	// TerminationInvalidOutput is a chained processor's output not matching its output schema
+	TerminationInvalidOutput = "invalid_output"
+)
+
+// ProcessorError describes why the external processor did not finish successfully
+type ProcessorError struct {
+	// Processor names the chained processor, empty for the built-in Python script
+	Processor string
+	Reason    string
+	ExitCode  int
+	// Signal is the signal that terminated the processor, empty when it exited
+	Signal  string
+	Runtime time.Duration
+	Err     error
+}
+
+// Error describes the termination
+func (e *ProcessorError) Error() string {
+	runtime := e.Runtime.Round(time.Millisecond)
+	name := "Python script"
+	if e.Processor != "" {
+		name = "Processor " + e.Processor
+	}
+	switch e.Reason {
+	case TerminationTimeout:
+		return fmt.Sprintf("%s killed after %s: timeout exceeded", name, runtime)
+	case TerminationCancelled:
+		return fmt.Sprintf("%s killed after %s: run cancelled", name, runtime)
+	case TerminationCPULimit:
+		return fmt.Sprintf("%s killed after %s: CPU time limit exceeded", name, runtime)
+	case TerminationMemoryLimit:
+		return fmt.Sprintf("%s failed after %s: address space limit exceeded (exit code %d)", name, runtime, e.ExitCode)
+	case TerminationSignal:
+		return fmt.Sprintf("%s terminated by signal %s after %s", name, e.Signal, runtime)
+	case TerminationException:
+		return fmt.Sprintf("Python worker failed after %s: %v", runtime, e.Err)
+	case TerminationInvalidInput:
+		return fmt.Sprintf("%s rejected its input: %v", name, e.Err)
+	case TerminationInvalidOutput:
+		return fmt.Sprintf("%s wrote output not matching its schema: %v", name, e.Err)
+	default:
+		return fmt.Sprintf("%s failed after %s: exit code %d", name, runtime, e.ExitCode)
+	}
+}
+
+// Unwrap returns the error reported by the process
+func (e *ProcessorError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether running the processor again on the same input can succeed.
+// Exceeded limits and rejected data are expected to repeat, so those stop the stage at once.
+func (e *ProcessorError) Retryable() bool {
+	switch e.Reason {
+	case TerminationTimeout, TerminationCPULimit, TerminationMemoryLimit, TerminationInvalidInput, TerminationInvalidOutput:
+		return false
+	}
+	return true
+}
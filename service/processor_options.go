@@ -0,0 +1,63 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/config"
+)
+
+// processWaitDelay bounds the wait for the output pipes of a killed processor
+const processWaitDelay = 10 * time.Second
+
+// ProcessorOptions holds the settings passed to the Python data processor
+type ProcessorOptions struct {
+	CutoffDate      string
+	Split           config.SplitConfig
+	ProfileTopK     int
+	GapFillEnabled  bool
+	GapFillStrategy string
+	// Holiday calendars used to compute weekend and holiday features
+	CalendarsEnabled bool
+	CalendarsPath    string
+	CalendarFiles    []string
+	RegionCalendars  string
+	// BaseCurrency is the currency all prices are converted to
+	BaseCurrency string
+	// Limits bound the runtime and resources of the processor
+	Limits config.ProcessorLimits
+}
+
+// args builds the command line flags for the Python data processor
+func (o ProcessorOptions) args() []string {
+	args := []string{
+		"--cutoff", o.CutoffDate,
+		"--profile-top-k", strconv.Itoa(o.ProfileTopK),
+		"--base-currency", o.BaseCurrency,
+		"--split-strategy", o.Split.Strategy,
+		"--test-days", strconv.Itoa(o.Split.TestDays),
+		"--validation-days", strconv.Itoa(o.Split.ValidationDays),
+		"--folds", strconv.Itoa(o.Split.Folds),
+		"--fold-days", strconv.Itoa(o.Split.FoldDays),
+		"--train-days", strconv.Itoa(o.Split.TrainDays),
+		"--gap-days", strconv.Itoa(o.Split.GapDays),
+		"--holdout-fraction", strconv.FormatFloat(o.Split.HoldoutFraction, 'f', -1, 64),
+	}
+
+	if !o.GapFillEnabled {
+		args = append(args, "--no-gap-fill")
+	} else if o.GapFillStrategy != "" {
+		args = append(args, "--fill-strategy", o.GapFillStrategy)
+	}
+
+	if !o.CalendarsEnabled {
+		args = append(args, "--no-calendars")
+	} else {
+		args = append(args, "--calendar-dir", o.CalendarsPath, "--region-calendars", o.RegionCalendars)
+		for _, file := range o.CalendarFiles {
+			args = append(args, "--calendar-file", file)
+		}
+	}
+
+	return args
+}
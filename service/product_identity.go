@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/product"
+)
+
+// assignProductIDs resolves the canonical product_id of every raw record.
+// Registered SKUs and marketplace IDs win; otherwise a stable ID is derived from them
+// and registered together with the record's aliases. The name is only a fallback for
+// records without identifiers.
+func (s *DataProcessorService) assignProductIDs(data []map[string]interface{}) error {
+	recordAliases := make([][]product.Alias, len(data))
+	var allAliases []product.Alias
+	for i, item := range data {
+		recordAliases[i] = product.RecordAliases(item)
+		allAliases = append(allAliases, recordAliases[i]...)
+	}
+
+	known := make(map[product.Alias]string)
+	if s.postgresRepo != nil {
+		resolved, err := s.postgresRepo.ResolveProductAliases(allAliases)
+		if err != nil {
+			return fmt.Errorf("failed to resolve product aliases: %w", err)
+		}
+		known = resolved
+	}
+
+	newProducts := make(map[string]*product.Product)
+	var order []string
+	unidentified := 0
+	conflicts := 0
+	for i, item := range data {
+		aliases := recordAliases[i]
+		if len(aliases) == 0 {
+			unidentified++
+			continue
+		}
+
+		productID, conflict := product.Resolve(aliases, known)
+		if conflict {
+			conflicts++
+		}
+		item["product_id"] = productID
+
+		// Remember aliases seen for the first time so they are registered
+		for _, alias := range aliases {
+			if _, ok := known[alias]; ok {
+				continue
+			}
+			known[alias] = productID
+
+			p, ok := newProducts[productID]
+			if !ok {
+				name, _ := item["product_name"].(string)
+				brand, _ := item["brand"].(string)
+				category, _ := item["category"].(string)
+				p = &product.Product{
+					ID:             productID,
+					CanonicalName:  strings.TrimSpace(name),
+					NormalizedName: product.NormalizeName(name),
+					Brand:          brand,
+					Category:       category,
+				}
+				newProducts[productID] = p
+				order = append(order, productID)
+			}
+			p.Aliases = append(p.Aliases, alias)
+		}
+	}
+
+	if unidentified > 0 {
+		s.logger.Warnf("%d records have no product name, SKU or marketplace ID", unidentified)
+	}
+	if conflicts > 0 {
+		s.logger.Warnf("%d records have a SKU and marketplace ID registered to different products, the SKU was used", conflicts)
+	}
+
+	if s.postgresRepo != nil && len(newProducts) > 0 {
+		products := make([]product.Product, 0, len(order))
+		for _, id := range order {
+			products = append(products, *newProducts[id])
+		}
+		if err := s.postgresRepo.RegisterProducts(products); err != nil {
+			return fmt.Errorf("failed to register products: %w", err)
+		}
+	}
+
+	s.logger.Infof("Resolved product IDs for %d records (%d new aliases)", len(data)-unidentified, countAliases(newProducts))
+	return nil
+}
+
+// BackfillProductIDs assigns product IDs to processed rows stored before product identity existed
+func (s *DataProcessorService) BackfillProductIDs() error {
+	if s.postgresRepo == nil {
+		return nil
+	}
+
+	names, err := s.postgresRepo.GetProductNamesWithoutID()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	records := make([]map[string]interface{}, len(names))
+	for i, name := range names {
+		records[i] = map[string]interface{}{"product_name": name}
+	}
+	if err := s.assignProductIDs(records); err != nil {
+		return err
+	}
+
+	var updated int64
+	for _, record := range records {
+		productID, ok := record["product_id"].(string)
+		if !ok {
+			continue
+		}
+		count, err := s.postgresRepo.SetProductIDByName(record["product_name"].(string), productID)
+		if err != nil {
+			return err
+		}
+		updated += count
+	}
+
+	s.logger.Infof("Backfilled product_id for %d processed rows of %d products", updated, len(names))
+	return nil
+}
+
+// countAliases returns the total number of aliases of the given products
+func countAliases(products map[string]*product.Product) int {
+	count := 0
+	for _, p := range products {
+		count += len(p.Aliases)
+	}
+	return count
+}
@@ -0,0 +1,505 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/config"
+	"go.uber.org/zap"
+)
+
+// workerMaxLine bounds a single protocol message read from the worker
+const workerMaxLine = 64 * 1024 * 1024
+
+// workerStartTimeout bounds the start of the worker, which imports pandas and the processor script
+const workerStartTimeout = time.Minute
+
+// errWorkerClosed is returned for requests sent after the worker was closed
+var errWorkerClosed = errors.New("Python worker is closed")
+
+// PythonWorker keeps a long-lived scripts/worker.py process and talks to it with line-delimited
+// JSON-RPC 2.0 over stdin and stdout. Requests are handled one at a time. The worker is pinged
+// while idle and restarted when it crashes or stops answering.
+type PythonWorker struct {
+	pythonPath      string
+	workerScript    string
+	processorScript string
+	limits          config.ProcessorLimits
+	healthInterval  time.Duration
+	healthTimeout   time.Duration
+	logger          *zap.SugaredLogger
+
+	// mu serializes requests and guards proc and nextID
+	mu     sync.Mutex
+	proc   *workerProcess
+	nextID int64
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// workerProcess is a running worker process
+type workerProcess struct {
+	stdin    io.WriteCloser
+	messages chan workerMessage
+	// kill kills the process group of the worker, killed is done once it was called
+	kill   context.CancelFunc
+	killed context.Context
+	// stopped is set when the worker is stopped on purpose, so its exit is not reported as a crash
+	stopped atomic.Bool
+	// exited is closed once the process has been waited for, then state is set
+	exited chan struct{}
+	state  *os.ProcessState
+}
+
+// workerRequest is a JSON-RPC request sent to the worker
+type workerRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// workerMessage is a JSON-RPC response or notification read from the worker
+type workerMessage struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *WorkerError    `json:"error"`
+}
+
+// WorkerError is an error response of the worker
+type WorkerError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		// Type is the Python exception class, Traceback its formatted traceback
+		Type      string `json:"type"`
+		Traceback string `json:"traceback"`
+	} `json:"data"`
+}
+
+// Error describes the error response
+func (e *WorkerError) Error() string {
+	if e.Data.Type != "" {
+		return fmt.Sprintf("%s: %s", e.Data.Type, e.Message)
+	}
+	return fmt.Sprintf("worker error %d: %s", e.Code, e.Message)
+}
+
+// WorkerInfo is the state of the worker reported by ping
+type WorkerInfo struct {
+	PID           int     `json:"pid"`
+	Python        string  `json:"python"`
+	Executable    string  `json:"executable"`
+	Prefix        string  `json:"prefix"`
+	Virtualenv    bool    `json:"virtualenv"`
+	Pandas        string  `json:"pandas"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+}
+
+// WorkerProgress is a progress notification sent while a batch is processed
+type WorkerProgress struct {
+	Step string `json:"step"`
+	Rows *int   `json:"rows,omitempty"`
+}
+
+// WorkerResult is the result of a processed batch
+type WorkerResult struct {
+	// Files maps each saved split to its CSV file
+	Files map[string]string `json:"files"`
+	Rows  map[string]int    `json:"rows"`
+}
+
+// NewPythonWorker creates a worker running processorScript, it is started by Start
+func NewPythonWorker(
+	pythonPath string,
+	processorScript string,
+	cfg config.WorkerConfig,
+	limits config.ProcessorLimits,
+	logger *zap.SugaredLogger,
+) *PythonWorker {
+	return &PythonWorker{
+		pythonPath:      pythonPath,
+		workerScript:    cfg.ScriptPath,
+		processorScript: processorScript,
+		limits:          limits,
+		healthInterval:  cfg.HealthInterval,
+		healthTimeout:   cfg.HealthTimeout,
+		logger:          logger,
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+}
+
+// Start starts the worker and its health checks, failing when the worker does not answer a ping
+func (w *PythonWorker) Start() error {
+	// The CPU time limit would add up over all runs of a long-lived worker
+	if w.limits.MaxCPUSeconds > 0 {
+		w.logger.Warn("PROCESSOR_MAX_CPU_SECONDS is not applied to the Python worker, PROCESSOR_MAX_RUNTIME_SECONDS bounds each batch")
+		w.limits.MaxCPUSeconds = 0
+	}
+
+	w.mu.Lock()
+	err := w.start()
+	w.mu.Unlock()
+	if err != nil {
+		close(w.done)
+		return err
+	}
+
+	go w.healthLoop()
+	return nil
+}
+
+// Process processes a batch in the worker. args are the processor's command line flags,
+// records the batch, progress is called for every progress notification.
+// A batch that does not finish successfully is reported as a *ProcessorError.
+func (w *PythonWorker) Process(ctx context.Context, args []string, records interface{}, progress func(WorkerProgress)) (*WorkerResult, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.ensureRunning(); err != nil {
+		return nil, err
+	}
+	p := w.proc
+
+	started := time.Now()
+	params := map[string]interface{}{"args": args, "records": records}
+	raw, err := w.call(ctx, "process", params, func(params json.RawMessage) {
+		var update WorkerProgress
+		if err := json.Unmarshal(params, &update); err == nil && progress != nil {
+			progress(update)
+		}
+	})
+	if err != nil {
+		return nil, w.processorError(ctx, p, err, time.Since(started))
+	}
+
+	var result WorkerResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid result from Python worker: %w", err)
+	}
+	return &result, nil
+}
+
+// Close stops the health checks and shuts the worker down
+func (w *PythonWorker) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.stop)
+	w.mu.Unlock()
+
+	<-w.done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p := w.proc
+	if p == nil {
+		return
+	}
+	select {
+	case <-p.exited:
+		return
+	default:
+	}
+
+	p.stopped.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), w.healthTimeout)
+	defer cancel()
+	if _, err := w.call(ctx, "shutdown", nil, nil); err != nil {
+		w.logger.Warnf("Python worker did not shut down cleanly: %v", err)
+	}
+	w.terminate(p)
+}
+
+// start starts a worker process and pings it, w.mu must be held
+func (w *PythonWorker) start() error {
+	killed, kill := context.WithCancel(context.Background())
+	command, args, err := limitedCommand(w.pythonPath, []string{w.workerScript, "--processor", w.processorScript}, w.limits)
+	if err != nil {
+		w.logger.Warnf("Failed to apply resource limits to the Python worker: %v", err)
+	}
+	cmd := exec.CommandContext(killed, command, args...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = processWaitDelay
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		kill()
+		return fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		kill()
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		kill()
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		kill()
+		return fmt.Errorf("failed to start Python worker: %w", err)
+	}
+
+	p := &workerProcess{
+		stdin:    stdin,
+		messages: make(chan workerMessage, 16),
+		kill:     kill,
+		killed:   killed,
+		exited:   make(chan struct{}),
+	}
+	w.proc = p
+
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		w.readMessages(p, stdout)
+	}()
+	go func() {
+		defer readers.Done()
+		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 64*1024), workerMaxLine)
+		for scanner.Scan() {
+			w.logger.Warn(scanner.Text())
+		}
+	}()
+
+	// Wait closes the pipes, so the readers are done once it returns
+	go func() {
+		err := cmd.Wait()
+		readers.Wait()
+		p.state = cmd.ProcessState
+		close(p.exited)
+		if !p.stopped.Load() {
+			w.logger.Errorf("Python worker (pid %d) exited unexpectedly: %v", cmd.Process.Pid, err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), workerStartTimeout)
+	defer cancel()
+	info, err := w.ping(ctx)
+	if err != nil {
+		w.terminate(p)
+		return fmt.Errorf("Python worker is not responding: %w", err)
+	}
+
+	w.logger.Infof("Python worker started (pid %d, Python %s, pandas %s, prefix %s)", info.PID, info.Python, info.Pandas, info.Prefix)
+	return nil
+}
+
+// readMessages passes the protocol messages written by the worker to the waiting request
+func (w *PythonWorker) readMessages(p *workerProcess, stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), workerMaxLine)
+	for scanner.Scan() {
+		var msg workerMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			w.logger.Warnf("Unexpected output from Python worker: %s", scanner.Text())
+			continue
+		}
+		select {
+		case p.messages <- msg:
+		case <-p.killed.Done():
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		w.logger.Errorf("Failed to read from Python worker: %v", err)
+		p.kill()
+	}
+}
+
+// ensureRunning restarts a worker that has exited, w.mu must be held
+func (w *PythonWorker) ensureRunning() error {
+	if w.closed {
+		return errWorkerClosed
+	}
+	if w.proc != nil {
+		select {
+		case <-w.proc.exited:
+		default:
+			return nil
+		}
+		w.logger.Warn("Restarting Python worker")
+	}
+	return w.start()
+}
+
+// call sends a request and waits for its response, passing notifications to notify.
+// The worker is killed when ctx ends first, w.mu must be held.
+func (w *PythonWorker) call(ctx context.Context, method string, params interface{}, notify func(json.RawMessage)) (json.RawMessage, error) {
+	p := w.proc
+	w.nextID++
+	id := w.nextID
+
+	line, err := json.Marshal(workerRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+
+	// A large batch fills the pipe, so the request is written while ctx is watched
+	written := make(chan error, 1)
+	go func() {
+		_, err := p.stdin.Write(append(line, '\n'))
+		written <- err
+	}()
+
+	for {
+		select {
+		case err := <-written:
+			if err != nil {
+				w.terminate(p)
+				return nil, fmt.Errorf("failed to send %s request to Python worker: %w", method, err)
+			}
+			written = nil
+		case <-ctx.Done():
+			w.terminate(p)
+			return nil, ctx.Err()
+		case <-p.exited:
+			// Messages written before the exit are handled first
+			if len(p.messages) > 0 {
+				continue
+			}
+			return nil, fmt.Errorf("Python worker exited during %s request", method)
+		case msg := <-p.messages:
+			if msg.ID == nil && msg.Method != "" {
+				if notify != nil {
+					notify(msg.Params)
+				}
+				continue
+			}
+			if msg.ID == nil || *msg.ID != id {
+				w.logger.Warnf("Ignoring unexpected response from Python worker: %+v", msg)
+				continue
+			}
+			if msg.Error != nil {
+				return nil, msg.Error
+			}
+			return msg.Result, nil
+		}
+	}
+}
+
+// ping asks the worker for its state, w.mu must be held
+func (w *PythonWorker) ping(ctx context.Context) (*WorkerInfo, error) {
+	raw, err := w.call(ctx, "ping", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var info WorkerInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, fmt.Errorf("invalid ping response: %w", err)
+	}
+	return &info, nil
+}
+
+// terminate kills the process group of a worker and waits until it has exited
+func (w *PythonWorker) terminate(p *workerProcess) {
+	p.stopped.Store(true)
+	p.stdin.Close()
+	p.kill()
+	<-p.exited
+}
+
+// healthLoop pings the idle worker and restarts it when it has exited or does not answer
+func (w *PythonWorker) healthLoop() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// A request in progress is watched by its own context
+		if !w.mu.TryLock() {
+			continue
+		}
+		w.checkHealth()
+		w.mu.Unlock()
+	}
+}
+
+// checkHealth pings the worker, w.mu must be held
+func (w *PythonWorker) checkHealth() {
+	if w.closed {
+		return
+	}
+	if w.proc != nil {
+		select {
+		case <-w.proc.exited:
+		default:
+			ctx, cancel := context.WithTimeout(context.Background(), w.healthTimeout)
+			_, err := w.ping(ctx)
+			cancel()
+			if err == nil {
+				return
+			}
+			w.logger.Errorf("Python worker failed health check: %v", err)
+			w.terminate(w.proc)
+		}
+	}
+
+	if err := w.ensureRunning(); err != nil {
+		w.logger.Errorf("Failed to restart Python worker: %v", err)
+	}
+}
+
+// processorError classifies a failed batch like a terminated processor process
+func (w *PythonWorker) processorError(ctx context.Context, p *workerProcess, err error, runtime time.Duration) error {
+	processorErr := &ProcessorError{Reason: TerminationException, Runtime: runtime, Err: err}
+
+	var workerErr *WorkerError
+	select {
+	case <-p.exited:
+		// The worker crashed or was killed, it is restarted by the next request or health check
+		processorErr.Reason = TerminationExit
+		processorErr.ExitCode = p.state.ExitCode()
+		processorErr.Signal = terminationSignal(p.state)
+		if processorErr.Signal != "" {
+			processorErr.Reason = TerminationSignal
+		}
+	default:
+		if !errors.As(err, &workerErr) {
+			return err
+		}
+		if workerErr.Data.Type == "" {
+			// Protocol errors such as invalid arguments are not processing failures
+			return err
+		}
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		processorErr.Reason = TerminationCancelled
+	case ctx.Err() != nil:
+		processorErr.Reason = TerminationTimeout
+	case workerErr != nil && workerErr.Data.Type == "MemoryError" && w.limits.MaxAddressSpaceMB > 0:
+		processorErr.Reason = TerminationMemoryLimit
+	}
+	return processorErr
+}
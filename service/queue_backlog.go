@@ -0,0 +1,14 @@
+package service
+
+import "time"
+
+// QueueDepth returns the number of messages waiting in the data queue
+func (s *DataProcessorService) QueueDepth() (int, error) {
+	return s.rabbitRepo.QueueDepth()
+}
+
+// OldestMessageTime returns when the oldest waiting message was published, or the zero time
+// when the queue is empty or the consumer does not know it
+func (s *DataProcessorService) OldestMessageTime() (time.Time, error) {
+	return s.rabbitRepo.OldestMessageTime()
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// scalersFilePath returns the versioned scalers file of a run
+func (s *DataProcessorService) scalersFilePath(runID string) string {
+	return filepath.Join(s.fileRepo.GetProcessedDataPath(), "artifacts", runID, "scalers.json")
+}
+
+// saveScalerParams stores the scalers fitted by the Python script in PostgreSQL
+func (s *DataProcessorService) saveScalerParams(runID string) error {
+	if len(s.featureSpec.ScaledColumns()) == 0 {
+		return nil
+	}
+
+	var params repository.ScalerParams
+	if err := s.fileRepo.LoadJSON(s.scalersFilePath(runID), &params); err != nil {
+		return err
+	}
+
+	return s.postgresRepo.SaveScalerParams(&params)
+}
+
+// GetScalers returns the scalers fitted during a run, or during the latest run when runID is empty.
+// PostgreSQL is queried first, the artifact files are used when the database is not available.
+func (s *DataProcessorService) GetScalers(runID string) (*repository.ScalerParams, error) {
+	// The run ID becomes part of the artifact path
+	if runID != "" && !runIDPattern.MatchString(runID) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidRunID, runID)
+	}
+
+	if s.postgresRepo != nil {
+		params, err := s.postgresRepo.GetScalerParams(runID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load scalers: %w", err)
+		}
+		if params != nil {
+			return params, nil
+		}
+	}
+
+	// The latest run's scalers are also kept next to train_data.csv
+	filePath := filepath.Join(s.fileRepo.GetProcessedDataPath(), "scalers.json")
+	if runID != "" {
+		filePath = s.scalersFilePath(runID)
+	}
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no scalers found for run %q", runID)
+	}
+
+	var params repository.ScalerParams
+	if err := s.fileRepo.LoadJSON(filePath, &params); err != nil {
+		return nil, fmt.Errorf("failed to load scalers: %w", err)
+	}
+	return &params, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// virtualenvCheckTimeout bounds the import check of the virtualenv's packages
+const virtualenvCheckTimeout = time.Minute
+
+// virtualenvPackages must be importable by the virtualenv's interpreter
+var virtualenvPackages = []string{"pandas", "numpy"}
+
+// VerifyVirtualenv checks that venv is a virtualenv whose interpreter runs inside it
+// and can import the packages the processor needs
+func VerifyVirtualenv(venv string) error {
+	if _, err := os.Stat(filepath.Join(venv, "pyvenv.cfg")); err != nil {
+		return fmt.Errorf("%s is not a virtualenv: %w", venv, err)
+	}
+
+	python := filepath.Join(venv, "bin", "python")
+	ctx, cancel := context.WithTimeout(context.Background(), virtualenvCheckTimeout)
+	defer cancel()
+
+	script := "import sys, " + strings.Join(virtualenvPackages, ", ") + "; print(sys.prefix)"
+	output, err := exec.CommandContext(ctx, python, "-c", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("interpreter of virtualenv %s failed: %w: %s", venv, err, strings.TrimSpace(string(output)))
+	}
+
+	// The interpreter may be a symlink, the prefix it reports must still be the virtualenv
+	prefix, err := filepath.EvalSymlinks(strings.TrimSpace(string(output)))
+	if err != nil {
+		return fmt.Errorf("failed to resolve prefix of virtualenv %s: %w", venv, err)
+	}
+	expected, err := filepath.EvalSymlinks(venv)
+	if err != nil {
+		return fmt.Errorf("failed to resolve virtualenv %s: %w", venv, err)
+	}
+	if prefix != expected {
+		return fmt.Errorf("interpreter of virtualenv %s runs in %s", venv, prefix)
+	}
+
+	return nil
+}